@@ -0,0 +1,295 @@
+package swmemdb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// RestoreMode decides what happens to existing keys when restoring a backup.
+type RestoreMode int
+
+const (
+	// RestoreMerge keeps existing keys. Keys present in the backup overwrite
+	// existing keys with the same name.
+	RestoreMerge RestoreMode = iota
+	// RestoreReplace deletes all existing keys before restoring the backup.
+	RestoreReplace
+)
+
+const (
+	// snapshotPrefix and snapshotSuffix surround the time of a snapshot in
+	// its file name.
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".db"
+	// snapshotTimeFormat sorts snapshot file names chronologically.
+	snapshotTimeFormat = "20060102T150405.000000000"
+)
+
+// WithSnapshotEvery writes a snapshot of the database to dir every d, keeping
+// the newest keep snapshots (all of them if keep is zero). A final snapshot
+// is written on Close. In memory mode the newest snapshot in dir is loaded
+// when the database is opened, so the data survives restarts.
+func WithSnapshotEvery(d time.Duration, dir string, keep int) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.snapshotEvery = d
+		o.snapshotDir = dir
+		o.snapshotKeep = keep
+	}
+}
+
+// Backup writes a snapshot of the whole database to w. The snapshot uses the
+// append only file format of the database file and can be read by Restore.
+func (db *DB) Backup(w io.Writer) error {
+	return db.db.Save(w)
+}
+
+// BackupCollection writes a snapshot of a single collection to w.
+func (db *DB) BackupCollection(w io.Writer, collection string) error {
+	tmp, err := bunt.Open(":memory:")
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	err = db.View(func(tx *Tx) error {
+		return tmp.Update(func(dst *bunt.Tx) error {
+			var err error
+			tx.tx.AscendKeys(collectionPattern(collection), func(key, value string) bool {
+				var ttl time.Duration
+				ttl, err = tx.tx.TTL(key)
+				if err == ErrNotFound {
+					// expired
+					err = nil
+					return true
+				} else if err != nil {
+					return false
+				}
+
+				_, _, err = dst.Set(key, value, expiryOptions(ttl))
+				return err == nil
+			})
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return tmp.Save(w)
+}
+
+// BackupToFile writes a snapshot of the whole database to path. The snapshot
+// is written to a temporary file first and renamed to path once complete, so
+// path always holds a complete snapshot.
+func (db *DB) BackupToFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	err = db.Backup(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// Restore reads a snapshot written by Backup or BackupCollection from r and
+// writes its keys to the database in a single transaction, keeping their
+// expiration. Errors reading the snapshot wrap ErrCorruptFile.
+func (db *DB) Restore(r io.Reader, mode RestoreMode) error {
+	return db.restore(r, mode, db.Tx)
+}
+
+// restore restores a snapshot inside a transaction run by update.
+func (db *DB) restore(r io.Reader, mode RestoreMode, update func(fn func(tx *Tx) error) error) error {
+	tmp, err := bunt.Open(":memory:")
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	if err := tmp.Load(r); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptFile, err)
+	}
+
+	return tmp.View(func(src *bunt.Tx) error {
+		return update(func(tx *Tx) error {
+			if mode == RestoreReplace {
+				if err := tx.deleteAll(); err != nil {
+					return err
+				}
+			}
+
+			var err error
+			src.Ascend("", func(key, stored string) bool {
+				if key == encryptionCheckKey {
+					// keep the check value of the current key
+					return true
+				}
+
+				var value string
+				if value, err = tx.db.decodeValue(stored); err != nil {
+					return false
+				}
+
+				var ttl time.Duration
+				ttl, err = src.TTL(key)
+				if err == ErrNotFound {
+					// expired
+					err = nil
+					return true
+				} else if err != nil {
+					return false
+				}
+
+				collection, k := splitKey(key)
+				err = tx.setStoredKey(key, collection, k, stored, value, expiryOptions(ttl))
+				return err == nil
+			})
+			return err
+		})
+	})
+}
+
+// Snapshot writes a snapshot of the database to the snapshot directory and
+// removes old snapshots as configured by WithSnapshotEvery.
+func (db *DB) Snapshot() error {
+	if db.opts.snapshotDir == "" {
+		return fmt.Errorf("%w: no snapshot directory", ErrInvalidConfig)
+	}
+
+	name := snapshotPrefix + time.Now().UTC().Format(snapshotTimeFormat) + snapshotSuffix
+	if err := db.BackupToFile(filepath.Join(db.opts.snapshotDir, name)); err != nil {
+		return err
+	}
+
+	if db.opts.snapshotKeep <= 0 {
+		return nil
+	}
+
+	snapshots, err := listSnapshots(db.opts.snapshotDir)
+	if err != nil {
+		return err
+	}
+
+	for len(snapshots) > db.opts.snapshotKeep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return nil
+}
+
+// snapshotLoop writes snapshots until stop is closed.
+func (db *DB) snapshotLoop(stop <-chan struct{}) {
+	defer db.snapshots.Done()
+
+	ticker := time.NewTicker(db.opts.snapshotEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// a failed snapshot is retried on the next tick
+			db.Snapshot()
+		}
+	}
+}
+
+// loadSnapshot loads the newest snapshot in dir, if any, into the in-memory
+// database bdb.
+func loadSnapshot(bdb *bunt.DB, dir string) error {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	latest := snapshots[len(snapshots)-1]
+	f, err := os.Open(latest)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrOpenFile, latest, err)
+	}
+	defer f.Close()
+
+	if err := bdb.Load(f); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrCorruptFile, latest, err)
+	}
+
+	return nil
+}
+
+// listSnapshots returns the paths of the snapshots in dir, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || len(name) != len(snapshotPrefix)+len(snapshotTimeFormat)+len(snapshotSuffix) {
+			continue
+		}
+		if name[:len(snapshotPrefix)] != snapshotPrefix || name[len(name)-len(snapshotSuffix):] != snapshotSuffix {
+			continue
+		}
+		snapshots = append(snapshots, filepath.Join(dir, name))
+	}
+	sort.Strings(snapshots)
+
+	return snapshots, nil
+}
+
+// deleteAll deletes every key of the database.
+func (tx *Tx) deleteAll() error {
+	var keys []string
+	err := tx.tx.Ascend("", func(key, value string) bool {
+		if key != encryptionCheckKey {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		collection, k := splitKey(key)
+		if err := tx.deleteKey(key, collection, k, EventDelete); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package swmemdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backupTestDb returns an in-memory database with two collections.
+func backupTestDb(t *testing.T) *DB {
+	db := NewBuntDb(WithMode("memory"))
+
+	err := db.Tx(func(tx *Tx) error {
+		if err := tx.Set("users", "alice", "1"); err != nil {
+			return err
+		}
+		if err := tx.Set("users", "bob", "2", time.Hour); err != nil {
+			return err
+		}
+		return tx.Set("orders", "1", "x")
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+
+	return db
+}
+
+// Test Backup and Restore of an in-memory database
+func TestBackupRestore(t *testing.T) {
+	db := backupTestDb(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	err := db.Backup(&buf)
+	if err != nil {
+		t.Fatalf("Backup() = %v, want %v", err, "nil")
+	}
+
+	restored := NewBuntDb(WithMode("memory"))
+	defer restored.Close()
+
+	err = restored.Restore(&buf, RestoreMerge)
+	if err != nil {
+		t.Fatalf("Restore() = %v, want %v", err, "nil")
+	}
+
+	names, err := restored.ListCollections()
+	if err != nil {
+		t.Errorf("ListCollections() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"orders", "users"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListCollections() = %v, want %v", names, want)
+	}
+
+	ttl, err := restored.TTLInCollection("users", "bob")
+	if err != nil {
+		t.Errorf("TTLInCollection() = %v, want %v", err, "nil")
+	}
+
+	if ttl <= 58*time.Minute || ttl > time.Hour {
+		t.Errorf("TTLInCollection() = %v, want %v", ttl, time.Hour)
+	}
+}
+
+// Test the merge and replace modes of Restore
+func TestRestoreModes(t *testing.T) {
+	db := backupTestDb(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	err := db.BackupCollection(&buf, "users")
+	if err != nil {
+		t.Fatalf("BackupCollection() = %v, want %v", err, "nil")
+	}
+	snapshot := buf.String()
+
+	target := NewBuntDb(WithMode("memory"))
+	defer target.Close()
+
+	err = target.Tx(func(tx *Tx) error {
+		if err := tx.Set("users", "alice", "old"); err != nil {
+			return err
+		}
+		return tx.Set("carts", "1", "y")
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+
+	err = target.Restore(strings.NewReader(snapshot), RestoreMerge)
+	if err != nil {
+		t.Fatalf("Restore() = %v, want %v", err, "nil")
+	}
+
+	names, _ := target.ListCollections()
+	if want := []string{"carts", "users"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListCollections() = %v, want %v", names, want)
+	}
+
+	val, _ := target.GetFromCollection("users", "alice")
+	if val != "1" {
+		t.Errorf("GetFromCollection() = %v, want %v", val, "1")
+	}
+
+	err = target.Restore(strings.NewReader(snapshot), RestoreReplace)
+	if err != nil {
+		t.Fatalf("Restore() = %v, want %v", err, "nil")
+	}
+
+	names, _ = target.ListCollections()
+	if want := []string{"users"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListCollections() = %v, want %v", names, want)
+	}
+}
+
+// Test Restore into a file database and with a corrupt snapshot
+func TestRestoreFileModeAndCorrupt(t *testing.T) {
+	db := backupTestDb(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+	err := db.BackupToFile(backup)
+	if err != nil {
+		t.Fatalf("BackupToFile() = %v, want %v", err, "nil")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("ReadDir() = %v entries, want %v", len(entries), 1)
+	}
+
+	target := NewBuntDb(WithMode("file"), WithFile(filepath.Join(dir, "target.db")))
+	defer target.Close()
+
+	f, err := os.Open(backup)
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer f.Close()
+
+	err = target.Restore(f, RestoreMerge)
+	if err != nil {
+		t.Fatalf("Restore() = %v, want %v", err, "nil")
+	}
+
+	stats, _ := target.CollectionStats("users")
+	if stats.Keys != 2 {
+		t.Errorf("CollectionStats() = %v, want %v", stats.Keys, 2)
+	}
+
+	err = target.Restore(strings.NewReader("garbage\n"), RestoreReplace)
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("Restore() = %v, want %v", err, ErrCorruptFile)
+	}
+
+	stats, _ = target.CollectionStats("users")
+	if stats.Keys != 2 {
+		t.Errorf("CollectionStats() = %v, want %v", stats.Keys, 2)
+	}
+}
+
+// Test that snapshots let an in-memory database survive a restart
+func TestSnapshotEvery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := Open(WithMode("memory"), WithSnapshotEvery(20*time.Millisecond, dir, 2))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+
+	err = db.SetToCollection("users", "alice", "1")
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = db.SetToCollection("users", "bob", "2")
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("Close() = %v, want %v", err, "nil")
+	}
+
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		t.Errorf("listSnapshots() = %v, want %v", err, "nil")
+	}
+
+	if len(snapshots) != 2 {
+		t.Errorf("listSnapshots() = %v, want %v snapshots", snapshots, 2)
+	}
+
+	db, err = Open(WithMode("memory"), WithSnapshotEvery(time.Hour, dir, 2))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	keys, err := db.GetKeysFromCollection("users")
+	if err != nil {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+}
@@ -3,6 +3,11 @@ package swmemdb
 // TODO: when no file is set, automatically set to memory mode
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	bunt "github.com/tidwall/buntdb"
@@ -15,19 +20,48 @@ type DB struct {
 	file       string
 	collection string
 	mode       string
+	opts       buntDbOptions
+	mu         sync.RWMutex
+	feed       feed
+	stop       chan struct{}
+	stopOnce   sync.Once
+	snapshots  sync.WaitGroup
+	cipher     atomic.Pointer[valueCipher]
+	writeMu    sync.Mutex
+	repl       replicator
+	replica    replicaState
+	metrics    metrics
+	usage      usage
+	loads      loadGroup
+	bus        bus
 }
 
 // buntDbOptions provides options for configuring a BuntDb.
 type buntDbOptions struct {
-	file                 string
-	collection           string
-	mode                 string
-	SyncPolicy           bunt.SyncPolicy
-	AutoShrinkDisabled   bool
-	AutoShrinkPercentage int
-	AutoShrinkMinSize    int
-	OnExpired            func(keys []string)
-	OnExpiredSync        func(key, value string, tx *bunt.Tx) error
+	file                  string
+	collection            string
+	mode                  string
+	SyncPolicy            bunt.SyncPolicy
+	AutoShrinkDisabled    bool
+	AutoShrinkPercentage  int
+	AutoShrinkMinSize     int
+	OnExpired             func(keys []string)
+	OnExpiredSync         func(key, value string, tx *bunt.Tx) error
+	indexes               []indexSpec
+	snapshotEvery         time.Duration
+	snapshotDir           string
+	snapshotKeep          int
+	encryptionKey         []byte
+	compression           compressionRule
+	collectionCompression map[string]compressionRule
+	replicaOf             string
+	metrics               bool
+	migrations            []Migration
+	limits                limits
+	collectionLimits      map[string]limits
+	evictionPolicy        EvictionPolicy
+	onRemoved             func(keys []string, reason RemovalReason)
+	retention             retention
 }
 
 // defaultBuntDbOptions provides default options for configuring a BuntDb.
@@ -40,8 +74,35 @@ func defaultBuntDbOptions() buntDbOptions {
 	}
 }
 
-// NewBuntDb creates a new BuntDb.
-func NewBuntDb(options ...BuntDbOptionsFn) *DB {
+// buntConfig overlays the options on top of the given bunt config. Zero
+// values leave the bunt defaults untouched.
+func (o buntDbOptions) buntConfig(config bunt.Config) bunt.Config {
+	config.SyncPolicy = o.SyncPolicy
+	config.AutoShrinkDisabled = o.AutoShrinkDisabled
+
+	if o.AutoShrinkPercentage != 0 {
+		config.AutoShrinkPercentage = o.AutoShrinkPercentage
+	}
+
+	if o.AutoShrinkMinSize != 0 {
+		config.AutoShrinkMinSize = o.AutoShrinkMinSize
+	}
+
+	if o.OnExpired != nil {
+		config.OnExpired = o.OnExpired
+	}
+
+	if o.OnExpiredSync != nil {
+		config.OnExpiredSync = o.OnExpiredSync
+	}
+
+	return config
+}
+
+// Open opens a database configured by the given options. Errors wrap one of
+// ErrInvalidMode, ErrOpenFile, ErrCorruptFile or ErrInvalidConfig and can be
+// matched with errors.Is.
+func Open(options ...BuntDbOptionsFn) (*DB, error) {
 	// default options
 	opts := defaultBuntDbOptions()
 
@@ -50,37 +111,143 @@ func NewBuntDb(options ...BuntDbOptionsFn) *DB {
 		option(&opts)
 	}
 
-	// create the database handle
-	db := &DB{
-		file:       opts.file, // getTempFileName(),
-		collection: opts.collection,
-		mode:       opts.mode,
+	db := &DB{opts: opts, stop: make(chan struct{})}
+	if err := db.open(); err != nil {
+		return nil, err
 	}
 
-	// options to bunt
-	buntOptions := &bunt.Config{
-		SyncPolicy:           opts.SyncPolicy,
-		AutoShrinkDisabled:   opts.AutoShrinkDisabled,
-		AutoShrinkPercentage: opts.AutoShrinkPercentage,
-		AutoShrinkMinSize:    opts.AutoShrinkMinSize,
-		OnExpired:            opts.OnExpired,
-		OnExpiredSync:        opts.OnExpiredSync,
+	// take snapshots in the background
+	if opts.snapshotEvery > 0 {
+		db.snapshots.Add(1)
+		go db.snapshotLoop(db.stop)
 	}
 
-	// set persistence mode (check if db.mode is set to memory or mem, let's say starts with m, then it's memory mode, otherwise it's file mode)
-	if db.mode[0] == 'm' {
-		// in memory
+	// follow the primary
+	if opts.replicaOf != "" {
+		go db.follow(opts.replicaOf, replicaRetryDelay, db.stop)
+	}
+
+	return db, nil
+}
+
+// NewBuntDb creates a new BuntDb. It panics if the database cannot be opened,
+// use Open to handle the error instead.
+func NewBuntDb(options ...BuntDbOptionsFn) *DB {
+	return mustReturn(Open(options...)).(*DB)
+}
+
+// open opens the underlying bunt database as described by db.opts.
+func (db *DB) open() error {
+	db.file = db.opts.file
+	db.collection = db.opts.collection
+	db.mode = db.opts.mode
+
+	// set persistence mode
+	memory, err := parseMode(db.mode)
+	if err != nil {
+		return err
+	}
+	if memory {
 		db.file = ":memory:"
 	}
 
 	// Open the data.db file. It will be created if it doesn't exist.
-	db.db = mustReturn(bunt.Open(db.file)).(*bunt.DB)
-	// read config
-	must(db.db.ReadConfig(buntOptions))
-	// set config
-	must(db.db.SetConfig(*buntOptions))
+	bdb, err := bunt.Open(db.file)
+	if err != nil {
+		if errors.Is(err, bunt.ErrInvalid) {
+			return fmt.Errorf("%w: %s: %w", ErrCorruptFile, db.file, err)
+		}
+		return fmt.Errorf("%w: %s: %w", ErrOpenFile, db.file, err)
+	}
+
+	// start from the bunt defaults and apply our options on top
+	var config bunt.Config
+	if err := bdb.ReadConfig(&config); err != nil {
+		bdb.Close()
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	config = db.opts.buntConfig(config)
+
+	// delete expired keys ourselves so that watchers see them expire
+	if config.OnExpiredSync == nil {
+		config.OnExpired = db.expireKeys(bdb, db.opts.OnExpired)
+	}
+
+	if err := bdb.SetConfig(config); err != nil {
+		bdb.Close()
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	// restore the newest snapshot of in-memory databases
+	if memory && db.opts.snapshotDir != "" {
+		if err := loadSnapshot(bdb, db.opts.snapshotDir); err != nil {
+			bdb.Close()
+			return err
+		}
+	}
+
+	// make sure existing values can be decrypted
+	valueCipher, err := newValueCipher(db.opts.encryptionKey)
+	if err != nil {
+		bdb.Close()
+		return err
+	}
+	if err := checkEncryption(bdb, valueCipher); err != nil {
+		bdb.Close()
+		return err
+	}
+	db.cipher.Store(valueCipher)
+
+	// recreate the indexes
+	err = bdb.Update(func(tx *bunt.Tx) error {
+		for _, spec := range db.opts.indexes {
+			if err := db.checkIndex(spec); err != nil {
+				return fmt.Errorf("index %s: %w", spec.name, err)
+			}
+			if err := spec.create(tx); err != nil {
+				return fmt.Errorf("index %s: %w", spec.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		bdb.Close()
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	// track the keys for eviction
+	if db.opts.limited() {
+		if err := db.usage.reset(bdb); err != nil {
+			bdb.Close()
+			return err
+		}
+	}
+
+	db.db = bdb
+
+	// apply pending migrations, replicas receive them from the primary
+	if len(db.opts.migrations) > 0 && db.opts.replicaOf == "" {
+		if _, err := db.Migrate(db.opts.migrations); err != nil {
+			bdb.Close()
+			return err
+		}
+	}
+
+	// evict keys loaded beyond the limits
+	db.evict()
+
+	return nil
+}
+
+// parseMode reports whether mode selects an in-memory database. Modes
+// starting with 'm' (memory, mem) are kept in memory, any other mode (file,
+// disk) persists to the configured file.
+func parseMode(mode string) (memory bool, err error) {
+	if mode == "" {
+		return false, fmt.Errorf("%w: empty mode", ErrInvalidMode)
+	}
 
-	return db
+	return mode[0] == 'm', nil
 }
 
 //
@@ -116,6 +283,21 @@ func WithSyncPolicy(syncPolicy bunt.SyncPolicy) BuntDbOptionsFn {
 	}
 }
 
+// ParseSyncPolicy parses the name of a sync policy: never, everysecond or
+// always.
+func ParseSyncPolicy(name string) (bunt.SyncPolicy, error) {
+	switch strings.ToLower(name) {
+	case "never":
+		return bunt.Never, nil
+	case "everysecond":
+		return bunt.EverySecond, nil
+	case "always":
+		return bunt.Always, nil
+	}
+
+	return 0, fmt.Errorf("%w: unknown sync policy %q", ErrInvalidConfig, name)
+}
+
 // WithAutoShrinkDisabled sets the auto shrink disabled flag.
 func WithAutoShrinkDisabled(autoShrinkDisabled bool) BuntDbOptionsFn {
 	return func(o *buntDbOptions) {
@@ -137,102 +319,80 @@ func WithAutoShrinkMinSize(autoShrinkMinSize int) BuntDbOptionsFn {
 	}
 }
 
-// WithOnExpired sets the on expired callback.
+// WithOnExpired sets the on expired callback. The expired keys have already
+// been deleted when it is called.
 func WithOnExpired(onExpired func(keys []string)) BuntDbOptionsFn {
 	return func(o *buntDbOptions) {
 		o.OnExpired = onExpired
 	}
 }
 
-// WithOnExpiredSync sets the on expired sync callback.
+// WithOnExpiredSync sets the on expired sync callback. The callback is
+// responsible for deleting the expired keys, and expirations are not
+// reported to watchers.
 func WithOnExpiredSync(onExpiredSync func(key, value string, tx *bunt.Tx) error) BuntDbOptionsFn {
 	return func(o *buntDbOptions) {
 		o.OnExpiredSync = onExpiredSync
 	}
 }
 
-// Init initializes the database.
+// Init reinitializes the database. The given options are applied on top of
+// the ones the handle was opened with, the current handle is closed and a new
+// one is opened.
 func (db *DB) Init(options ...BuntDbOptionsFn) error {
 
-	// buntdb config
-	config := buntDbOptions{}
-
 	// apply user options
 	for _, option := range options {
-		option(&config)
-	}
-
-	// options to bunt
-	buntOptions := &bunt.Config{
-		SyncPolicy:           config.SyncPolicy,
-		AutoShrinkDisabled:   config.AutoShrinkDisabled,
-		AutoShrinkPercentage: config.AutoShrinkPercentage,
-		AutoShrinkMinSize:    config.AutoShrinkMinSize,
-		OnExpired:            config.OnExpired,
-		OnExpiredSync:        config.OnExpiredSync,
-	}
-
-	// if set to config, use it
-	if config.AutoShrinkPercentage != 0 {
-		buntOptions.AutoShrinkPercentage = config.AutoShrinkPercentage
-	} else {
-		buntOptions.AutoShrinkPercentage = 100
-	}
-
-	// if set to config, use it
-	if config.AutoShrinkMinSize != 0 {
-		buntOptions.AutoShrinkMinSize = config.AutoShrinkMinSize
-	} else {
-		buntOptions.AutoShrinkMinSize = 32
-	}
-
-	// if set to config, use it
-	if config.OnExpired != nil {
-		buntOptions.OnExpired = config.OnExpired
+		option(&db.opts)
 	}
 
-	// if set to config, use it
-	if config.OnExpiredSync != nil {
-		buntOptions.OnExpiredSync = config.OnExpiredSync
-	}
-
-	// if collection is set, use it
-	if config.collection != "" {
-		db.collection = config.collection
-	}
-
-	// read config
-	must(db.db.ReadConfig(buntOptions))
-
-	// set config
-	must(db.db.SetConfig(*buntOptions))
-
-	// set MEM mode if needed
-	if db.mode[0] == 'm' {
-		// in memory
-		db.file = ":memory:"
+	// close the current handle, if any
+	if db.db != nil {
+		if err := db.db.Close(); err != nil && !errors.Is(err, bunt.ErrDatabaseClosed) {
+			return err
+		}
 	}
 
 	// open the database
-	db.db = mustReturn(bunt.Open(db.file)).(*bunt.DB)
-
-	return nil
+	return db.open()
 }
 
-// Close closes the database.
+// Close closes the database and stops all watchers and subscribers. If
+// snapshots are configured a final snapshot is written first.
 func (db *DB) Close() error {
 
+	// stop the background work and write a final snapshot
+	var snapshotErr error
+	db.stopOnce.Do(func() {
+		close(db.stop)
+		if db.opts.snapshotEvery > 0 {
+			// let a running snapshot finish before the final one
+			db.snapshots.Wait()
+			snapshotErr = db.Snapshot()
+		}
+	})
+
+	// stop the watchers, subscribers and replication connections
+	db.feed.close()
+	db.bus.close()
+	db.repl.close()
+
 	// close the database
-	return db.db.Close()
+	if err := db.db.Close(); err != nil {
+		return err
+	}
+
+	return snapshotErr
 }
 
-// Set sets the value for a key.
+// Set sets the value for a key. A zero expiration means the value never
+// expires.
 func (db *DB) Set(key string, value string, exp time.Duration) error {
 
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
 
 		// set the key/value
-		_, _, err := tx.Set(db.collection+":"+key, value, &bunt.SetOptions{Expires: true, TTL: exp})
+		err := tx.set(db.collection, key, value, expiryOptions(exp))
 		if err != nil {
 			return err
 		}
@@ -242,13 +402,14 @@ func (db *DB) Set(key string, value string, exp time.Duration) error {
 
 }
 
-// Update updates the value for a key.
+// Update updates the value for a key. A zero expiration means the value
+// never expires.
 func (db *DB) Update(key string, value string, exp time.Duration) error {
 
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
 
 		// set the key/value
-		_, _, err := tx.Set(db.collection+":"+key, value, &bunt.SetOptions{Expires: true, TTL: exp})
+		err := tx.set(db.collection, key, value, expiryOptions(exp))
 		if err != nil {
 			return err
 		}
@@ -261,10 +422,10 @@ func (db *DB) Update(key string, value string, exp time.Duration) error {
 // UpdateWithNoExpiration updates the value for a key with no expiration.
 func (db *DB) UpdateWithNoExpiration(key string, value string) error {
 
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
 
 		// set the key/value
-		_, _, err := tx.Set(db.collection+":"+key, value, &bunt.SetOptions{Expires: false})
+		err := tx.set(db.collection, key, value, &bunt.SetOptions{Expires: false})
 		if err != nil {
 			return err
 		}
@@ -277,10 +438,10 @@ func (db *DB) UpdateWithNoExpiration(key string, value string) error {
 // SetWithNoExpiration sets the value for a key with no expiration.
 func (db *DB) SetWithNoExpiration(key string, value string) error {
 
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
 
 		// set the key/value
-		_, _, err := tx.Set(db.collection+":"+key, value, &bunt.SetOptions{Expires: false})
+		err := tx.set(db.collection, key, value, &bunt.SetOptions{Expires: false})
 		if err != nil {
 			return err
 		}
@@ -293,14 +454,11 @@ func (db *DB) SetWithNoExpiration(key string, value string) error {
 // Get gets the value for a key.
 func (db *DB) Get(key string) (interface{}, error) {
 	var value interface{}
-	err := db.db.View(func(tx *bunt.Tx) error {
-		val, err := tx.Get(db.collection + ":" + key)
+	err := db.View(func(tx *Tx) error {
+		val, err := tx.Get(db.collection, key)
 		if err != nil {
-			if err.Error() == bunt.ErrNotFound.Error() {
-
-				value = ""
-				return err
-			}
+			value = ""
+			return err
 		}
 
 		value = val
@@ -311,7 +469,8 @@ func (db *DB) Get(key string) (interface{}, error) {
 	return value, err
 }
 
-// SetToCollection sets the value for a key in a collection.
+// SetToCollection sets the value for a key in a collection. Without an
+// expiration the value never expires.
 func (db *DB) SetToCollection(collection string, key string, value string, exps ...time.Duration) error {
 
 	var exp time.Duration
@@ -321,10 +480,10 @@ func (db *DB) SetToCollection(collection string, key string, value string, exps
 		exp = 0
 	}
 
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
 
 		// set the key/value
-		_, _, err := tx.Set(collection+":"+key, value, &bunt.SetOptions{Expires: true, TTL: exp})
+		err := tx.set(collection, key, value, expiryOptions(exp))
 		if err != nil {
 			return err
 		}
@@ -334,13 +493,20 @@ func (db *DB) SetToCollection(collection string, key string, value string, exps
 
 }
 
-// UpdateToCollection updates the value for a key in a collection.
+// UpdateToCollection updates the value for a key in a collection, keeping its
+// remaining expiration.
 func (db *DB) UpdateToCollection(collection string, key string, value string) error {
 
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
+
+		// keep the remaining time to live of the key, if any
+		ttl, err := tx.TTL(collection, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
 
 		// set the key/value
-		_, _, err := tx.Set(collection+":"+key, value, &bunt.SetOptions{Expires: true})
+		err = tx.set(collection, key, value, expiryOptions(ttl))
 		if err != nil {
 			return err
 		}
@@ -353,14 +519,11 @@ func (db *DB) UpdateToCollection(collection string, key string, value string) er
 // GetFromCollection gets the value for a key from a collection.
 func (db *DB) GetFromCollection(collection string, key string) (interface{}, error) {
 	var value interface{}
-	err := db.db.View(func(tx *bunt.Tx) error {
-		val, err := tx.Get(collection + ":" + key)
+	err := db.View(func(tx *Tx) error {
+		val, err := tx.Get(collection, key)
 		if err != nil {
-			if err.Error() == bunt.ErrNotFound.Error() {
-
-				value = ""
-				return err
-			}
+			value = ""
+			return err
 		}
 
 		value = val
@@ -373,10 +536,10 @@ func (db *DB) GetFromCollection(collection string, key string) (interface{}, err
 
 // DeleteFromCollection deletes a key/value pair from a collection.
 func (db *DB) DeleteFromCollection(collection string, key string) error {
-	return db.db.Update(func(tx *bunt.Tx) error {
-		_, err := tx.Delete(collection + ":" + key)
+	return db.Tx(func(tx *Tx) error {
+		err := tx.Delete(collection, key)
 		if err != nil {
-			if err.Error() == bunt.ErrNotFound.Error() {
+			if err == ErrNotFound {
 				return err
 			} else {
 				return nil
@@ -390,10 +553,10 @@ func (db *DB) DeleteFromCollection(collection string, key string) error {
 
 // Delete deletes a key/value pair.
 func (db *DB) Delete(key string) error {
-	return db.db.Update(func(tx *bunt.Tx) error {
-		_, err := tx.Delete(db.collection + ":" + key)
+	return db.Tx(func(tx *Tx) error {
+		err := tx.Delete(db.collection, key)
 		if err != nil {
-			if err.Error() == bunt.ErrNotFound.Error() {
+			if err == ErrNotFound {
 				return err
 			}
 		}
@@ -418,7 +581,7 @@ func (db *DB) Delete(key string) error {
 
 // DeleteWhere deletes all key/value pairs that match the condition.
 func (db *DB) DeleteWhere(condition func(key string, value string) bool) error {
-	// return db.db.Update(func(tx *bunt.Tx) error {
+	// return db.Tx(func(tx *Tx) error {
 
 	// 	var delkeys []string
 	// 	tx.AscendKeys("*", func(k, v string) bool {
@@ -437,18 +600,23 @@ func (db *DB) DeleteWhere(condition func(key string, value string) bool) error {
 	// 	return nil
 
 	// })
-	return db.db.Update(func(tx *bunt.Tx) error {
+	return db.Tx(func(tx *Tx) error {
 
 		var delkeys []string
-		tx.AscendKeys(db.collection+":*", func(k, v string) bool {
-			if condition(k, v) {
-				delkeys = append(delkeys, k)
+		var decodeErr error
+		tx.tx.AscendKeys(db.collection+":*", db.decodeIterator(0, &decodeErr, func(k, v string) bool {
+			if !isElementKey(k[len(db.collection)+1:]) && condition(k, v) {
+				delkeys = append(delkeys, k[len(db.collection)+1:])
 			}
 			return true // continue
-		})
+		}))
+		if decodeErr != nil {
+			return decodeErr
+		}
 
 		for _, k := range delkeys {
-			if _, err := tx.Delete(k); err != nil {
+			// elements of a structure are deleted with it
+			if err := tx.Delete(db.collection, k); err != nil && err != ErrNotFound {
 				return err
 			}
 		}
@@ -469,8 +637,10 @@ func (db *DB) GetKeys() ([]string, error) {
 		err := tx.AscendKeys(db.collection+":*", func(key, value string) bool {
 			// strip the collection name
 			key = key[len(db.collection)+1:]
-			// append the key
-			keys = append(keys, key)
+			// append the key, unless it is an element of a structure
+			if !isElementKey(key) {
+				keys = append(keys, key)
+			}
 			return true
 		})
 
@@ -491,8 +661,10 @@ func (db *DB) GetKeysFromCollection(collection string) ([]string, error) {
 		err := tx.AscendKeys(collection+":*", func(key, value string) bool {
 			// strip the collection name
 			key = key[len(collection)+1:]
-			// append the key
-			keys = append(keys, key)
+			// append the key, unless it is an element of a structure
+			if !isElementKey(key) {
+				keys = append(keys, key)
+			}
 			return true
 		})
 
@@ -502,6 +674,40 @@ func (db *DB) GetKeysFromCollection(collection string) ([]string, error) {
 	return keys, err
 }
 
+// metaCollection is reserved for data the database keeps about itself. It is
+// left out of ListCollections.
+const metaCollection = "_meta"
+
+// collectionKey returns the database key of key in collection.
+func collectionKey(collection, key string) string {
+	return collection + ":" + key
+}
+
+// splitKey splits a database key into its collection and the key within the
+// collection. Keys without a collection have an empty collection.
+func splitKey(key string) (collection, k string) {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+
+	return "", key
+}
+
+// collectionPattern returns the pattern matching all keys of collection.
+func collectionPattern(collection string) string {
+	return collection + ":*"
+}
+
+// expiryOptions returns the set options for an expiration. A zero or negative
+// expiration means the value never expires.
+func expiryOptions(exp time.Duration) *bunt.SetOptions {
+	if exp <= 0 {
+		return &bunt.SetOptions{Expires: false}
+	}
+
+	return &bunt.SetOptions{Expires: true, TTL: exp}
+}
+
 // must is a helper that wraps a call returning (_, error) and panics if the
 // error is non-nil.
 func must(err error) {
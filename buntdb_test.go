@@ -1250,6 +1250,161 @@ func TestUpdateWithNoExpiration(t *testing.T) {
 
 }
 
+// Test Open
+func TestOpen(t *testing.T) {
+	db, err := Open(WithMode("memory"), WithCollection("testtable"))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+
+	err = db.Set("testkey", "testvalue", 10*time.Second)
+	if err != nil {
+		t.Errorf("Set() = %v, want %v", err, "nil")
+	}
+
+	val, err := db.Get("testkey")
+	if err != nil {
+		t.Errorf("Get() = %v, want %v", err, "nil")
+	}
+
+	if val != "testvalue" {
+		t.Errorf("Get() = %v, want %v", val, "testvalue")
+	}
+
+	// close the connection
+	err = db.Close()
+	if err != nil {
+		t.Errorf("Close() = %v, want %v", err, "nil")
+	}
+}
+
+// Test Open with an invalid mode
+func TestOpenWithInvalidMode(t *testing.T) {
+	db, err := Open(WithMode(""))
+	if !errors.Is(err, ErrInvalidMode) {
+		t.Errorf("Open() = %v, want %v", err, ErrInvalidMode)
+	}
+
+	if db != nil {
+		t.Errorf("Open() = %v, want %v", db, "nil")
+	}
+}
+
+// Test modes not starting with 'm' open a file
+func TestOpenWithDiskMode(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(WithFile(file), WithMode("disk"))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	if err := db.Set("a", "1", 0); err != nil {
+		t.Errorf("Set() = %v, want %v", err, "nil")
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Stat() = %v, want %v", err, "nil")
+	}
+}
+
+// Test Open with a file that cannot be created
+func TestOpenWithMissingDirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "missing", "test.db")
+	_, err := Open(WithFile(file), WithMode("file"))
+	if !errors.Is(err, ErrOpenFile) {
+		t.Errorf("Open() = %v, want %v", err, ErrOpenFile)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open() = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+// Test Open with a corrupt file
+func TestOpenWithCorruptFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "corrupt.db")
+	err := os.WriteFile(file, []byte("this is not an aof file\n"), 0666)
+	if err != nil {
+		t.Fatalf("WriteFile() = %v, want %v", err, "nil")
+	}
+
+	_, err = Open(WithFile(file), WithMode("file"))
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("Open() = %v, want %v", err, ErrCorruptFile)
+	}
+}
+
+// Test Open with an invalid sync policy
+func TestOpenWithInvalidSyncPolicy(t *testing.T) {
+	_, err := Open(WithMode("memory"), WithSyncPolicy(buntdb.SyncPolicy(42)))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Open() = %v, want %v", err, ErrInvalidConfig)
+	}
+}
+
+// Test that Open applies the bunt options
+func TestOpenAppliesOptions(t *testing.T) {
+	db, err := Open(WithMode("memory"), WithSyncPolicy(buntdb.Always), WithAutoShrinkMinSize(1024))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	var config buntdb.Config
+	err = db.db.ReadConfig(&config)
+	if err != nil {
+		t.Fatalf("ReadConfig() = %v, want %v", err, "nil")
+	}
+
+	if config.SyncPolicy != buntdb.Always {
+		t.Errorf("SyncPolicy = %v, want %v", config.SyncPolicy, buntdb.Always)
+	}
+
+	if config.AutoShrinkMinSize != 1024 {
+		t.Errorf("AutoShrinkMinSize = %v, want %v", config.AutoShrinkMinSize, 1024)
+	}
+}
+
+// Test that NewBuntDb panics when the database cannot be opened
+func TestNewBuntDbPanics(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("The code did not panic")
+		}
+
+		if err, ok := r.(error); !ok || !errors.Is(err, ErrInvalidMode) {
+			t.Errorf("NewBuntDb() panicked with %v, want %v", r, ErrInvalidMode)
+		}
+	}()
+
+	NewBuntDb(WithMode(""))
+}
+
+// Test ParseSyncPolicy
+func TestParseSyncPolicy(t *testing.T) {
+	for name, want := range map[string]buntdb.SyncPolicy{
+		"never":       buntdb.Never,
+		"everysecond": buntdb.EverySecond,
+		"Always":      buntdb.Always,
+	} {
+		policy, err := ParseSyncPolicy(name)
+		if err != nil {
+			t.Errorf("ParseSyncPolicy(%q) = %v, want %v", name, err, "nil")
+		}
+
+		if policy != want {
+			t.Errorf("ParseSyncPolicy(%q) = %v, want %v", name, policy, want)
+		}
+	}
+
+	_, err := ParseSyncPolicy("sometimes")
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("ParseSyncPolicy() = %v, want %v", err, ErrInvalidConfig)
+	}
+}
+
 // getTempFileName returns a temporary file name. [unix timestamp].db
 func getTempFileName(n ...string) string {
 	var label string
@@ -0,0 +1,61 @@
+// Command swmemdb-resp serves a database over the Redis protocol.
+//
+//	swmemdb-resp -addr :6379 -mode file -file data.db -sync everysecond
+//
+// See swmemdb.ServeRESP for the supported commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	swmemdb "github.com/boomhut/sw-memdb"
+)
+
+func main() {
+	addr := flag.String("addr", ":6379", "address to listen on")
+	file := flag.String("file", "data.db", "database file used in file mode")
+	mode := flag.String("mode", "memory", "storage mode: memory or file")
+	syncName := flag.String("sync", "everysecond", "sync policy: never, everysecond or always")
+	flag.Parse()
+
+	syncPolicy, err := swmemdb.ParseSyncPolicy(*syncName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := swmemdb.Open(swmemdb.WithFile(*file), swmemdb.WithMode(*mode), swmemdb.WithSyncPolicy(syncPolicy))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// stop accepting connections on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	log.Printf("swmemdb-resp listening on %s", ln.Addr())
+	err = swmemdb.ServeRESP(ln, db)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
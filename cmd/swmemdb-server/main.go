@@ -0,0 +1,106 @@
+// Command swmemdb-server serves a database over HTTP.
+//
+//	swmemdb-server -addr :8080 -mode file -file data.db -sync everysecond
+//
+// With -replication-addr the server also serves replication to replicas,
+// which are started with -replica-of pointing at that address and are
+// read-only.
+//
+// Metrics are served in the Prometheus text format on /metrics. See
+// swmemdb.NewHTTPHandler for the other routes.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	swmemdb "github.com/boomhut/sw-memdb"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	file := flag.String("file", "data.db", "database file used in file mode")
+	mode := flag.String("mode", "memory", "storage mode: memory or file")
+	syncName := flag.String("sync", "everysecond", "sync policy: never, everysecond or always")
+	replicationAddr := flag.String("replication-addr", "", "address to serve replication on")
+	replicaOf := flag.String("replica-of", "", "replication address of the primary to follow")
+	maxBodySize := flag.Int64("max-body-size", 1<<20, "largest value accepted on PUT, in bytes")
+	flag.Parse()
+
+	syncPolicy, err := swmemdb.ParseSyncPolicy(*syncName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options := []swmemdb.BuntDbOptionsFn{swmemdb.WithFile(*file), swmemdb.WithMode(*mode), swmemdb.WithSyncPolicy(syncPolicy), swmemdb.WithMetrics()}
+	if *replicaOf != "" {
+		options = append(options, swmemdb.WithReplicaOf(*replicaOf))
+	}
+
+	db, err := swmemdb.Open(options...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *replicationAddr != "" {
+		ln, err := net.Listen("tcp", *replicationAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ln.Close()
+
+		log.Printf("swmemdb-server serving replication on %s", *replicationAddr)
+		go swmemdb.ServeReplication(ln, db)
+	}
+
+	// route by hand, a ServeMux would clean escaped keys
+	api, metrics := swmemdb.NewHTTPHandler(db, swmemdb.MaxBodySize(*maxBodySize)), swmemdb.NewMetricsHandler(db)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// shut down gracefully on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("swmemdb-server listening on %s", *addr)
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+
+	// wait for in-flight requests before closing the database
+	<-shutdown
+
+	if err := db.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
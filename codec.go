@@ -0,0 +1,47 @@
+package swmemdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec converts values to and from the strings stored in the database.
+type Codec interface {
+	// Marshal encodes v.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values as JSON. JSON values can be used with the
+// IndexJSON based indexes of the underlying database.
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values with encoding/gob.
+type GobCodec struct{}
+
+// Marshal encodes v with gob.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes gob data into v.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,46 @@
+package swmemdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+type codecTestValue struct {
+	Name string
+	Tags []string
+	Age  int
+}
+
+// Test that the shipped codecs round-trip values
+func TestCodecsRoundTrip(t *testing.T) {
+	in := codecTestValue{Name: "alice", Tags: []string{"a", "b"}, Age: 42}
+
+	for name, codec := range map[string]Codec{"json": JSONCodec{}, "gob": GobCodec{}} {
+		data, err := codec.Marshal(in)
+		if err != nil {
+			t.Errorf("%s Marshal() = %v, want %v", name, err, "nil")
+			continue
+		}
+
+		var out codecTestValue
+		err = codec.Unmarshal(data, &out)
+		if err != nil {
+			t.Errorf("%s Unmarshal() = %v, want %v", name, err, "nil")
+		}
+
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%s Unmarshal() = %v, want %v", name, out, in)
+		}
+	}
+}
+
+// Test that the codecs reject garbage
+func TestCodecsUnmarshalInvalid(t *testing.T) {
+	for name, codec := range map[string]Codec{"json": JSONCodec{}, "gob": GobCodec{}} {
+		var out codecTestValue
+		err := codec.Unmarshal([]byte("not encoded"), &out)
+		if err == nil {
+			t.Errorf("%s Unmarshal() = %v, want %v", name, err, "error")
+		}
+	}
+}
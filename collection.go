@@ -0,0 +1,132 @@
+package swmemdb
+
+import (
+	"fmt"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// DecodeError is returned when a stored value cannot be decoded by the codec
+// of a typed collection or as the state of a rate limiter.
+type DecodeError struct {
+	Collection string
+	Key        string
+	Err        error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("swmemdb: cannot decode %s: %v", collectionKey(e.Collection, e.Key), e.Err)
+}
+
+// Unwrap returns the underlying codec error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Collection is a handle to a collection whose values are of type T. Values
+// are encoded with the collection's codec before they are stored.
+type Collection[T any] struct {
+	db    *DB
+	name  string
+	codec Codec
+}
+
+// TypedCollection returns a handle to the named collection storing values of
+// type T encoded with codec. If codec is nil, JSONCodec is used.
+func TypedCollection[T any](db *DB, name string, codec Codec) *Collection[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return &Collection[T]{db: db, name: name, codec: codec}
+}
+
+// Name returns the collection name.
+func (c *Collection[T]) Name() string {
+	return c.name
+}
+
+// Put encodes and stores the value for a key. An optional expiration may be
+// given, without one the value never expires.
+func (c *Collection[T]) Put(key string, value T, exps ...time.Duration) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	var exp time.Duration
+	if len(exps) > 0 {
+		exp = exps[0]
+	}
+
+	return c.db.Tx(func(tx *Tx) error {
+		return tx.Set(c.name, key, string(data), exp)
+	})
+}
+
+// Get gets and decodes the value for a key.
+func (c *Collection[T]) Get(key string) (T, error) {
+	var value T
+	var raw string
+
+	err := c.db.View(func(tx *Tx) error {
+		var err error
+		raw, err = tx.Get(c.name, key)
+		return err
+	})
+	if err != nil {
+		return value, err
+	}
+
+	return c.decode(key, raw)
+}
+
+// Delete deletes the value for a key.
+func (c *Collection[T]) Delete(key string) error {
+	return c.db.DeleteFromCollection(c.name, key)
+}
+
+// Keys returns all keys of the collection.
+func (c *Collection[T]) Keys() ([]string, error) {
+	return c.db.GetKeysFromCollection(c.name)
+}
+
+// Scan calls fn for every key/value pair of the collection in key order
+// until fn returns false. Scan stops with a *DecodeError if a value cannot be
+// decoded.
+func (c *Collection[T]) Scan(fn func(key string, value T) bool) error {
+	return c.db.db.View(func(tx *bunt.Tx) error {
+		var decodeErr error
+
+		err := tx.AscendKeys(collectionPattern(c.name), c.db.decodeIterator(len(c.name)+1, &decodeErr, func(key, v string) bool {
+			if isElementKey(key) {
+				return true
+			}
+
+			value, err := c.decode(key, v)
+			if err != nil {
+				decodeErr = err
+				return false
+			}
+
+			return fn(key, value)
+		}))
+		if err != nil {
+			return err
+		}
+
+		return decodeErr
+	})
+}
+
+// decode decodes a raw value stored under key.
+func (c *Collection[T]) decode(key, raw string) (T, error) {
+	var value T
+	if err := c.codec.Unmarshal([]byte(raw), &value); err != nil {
+		return value, &DecodeError{Collection: c.name, Key: key, Err: err}
+	}
+
+	return value, nil
+}
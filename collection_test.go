@@ -0,0 +1,144 @@
+package swmemdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+type collectionTestUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Age   int    `json:"age"`
+}
+
+// Test Put and Get on a typed collection
+func TestTypedCollectionPutGet(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	for name, codec := range map[string]Codec{"json": JSONCodec{}, "gob": GobCodec{}} {
+		users := TypedCollection[collectionTestUser](db, "users_"+name, codec)
+
+		alice := collectionTestUser{Name: "alice", Email: "alice@example.com", Age: 30}
+		err := users.Put("alice", alice)
+		if err != nil {
+			t.Errorf("Put() = %v, want %v", err, "nil")
+		}
+
+		got, err := users.Get("alice")
+		if err != nil {
+			t.Errorf("Get() = %v, want %v", err, "nil")
+		}
+
+		if !reflect.DeepEqual(got, alice) {
+			t.Errorf("Get() = %v, want %v", got, alice)
+		}
+	}
+}
+
+// Test that a typed collection stores JSON readable by the untyped API
+func TestTypedCollectionIsVisibleToUntypedAPI(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	users := TypedCollection[collectionTestUser](db, "users", nil)
+	err := users.Put("bob", collectionTestUser{Name: "bob", Age: 25})
+	if err != nil {
+		t.Errorf("Put() = %v, want %v", err, "nil")
+	}
+
+	val, err := db.GetFromCollection("users", "bob")
+	if err != nil {
+		t.Errorf("GetFromCollection() = %v, want %v", err, "nil")
+	}
+
+	want := `{"name":"bob","email":"","age":25}`
+	if val != want {
+		t.Errorf("GetFromCollection() = %v, want %v", val, want)
+	}
+}
+
+// Test Get with a missing key on a typed collection
+func TestTypedCollectionGetMissing(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	users := TypedCollection[collectionTestUser](db, "users", JSONCodec{})
+	_, err := users.Get("nobody")
+	if !errors.Is(err, buntdb.ErrNotFound) {
+		t.Errorf("Get() = %v, want %v", err, buntdb.ErrNotFound)
+	}
+}
+
+// Test that undecodable values return a DecodeError with the key
+func TestTypedCollectionDecodeError(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	err := db.SetToCollection("users", "broken", "{not json", time.Minute)
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	users := TypedCollection[collectionTestUser](db, "users", JSONCodec{})
+	_, err = users.Get("broken")
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Get() = %v, want %v", err, "*DecodeError")
+	}
+
+	if decodeErr.Collection != "users" || decodeErr.Key != "broken" {
+		t.Errorf("DecodeError = %v:%v, want %v:%v", decodeErr.Collection, decodeErr.Key, "users", "broken")
+	}
+
+	err = users.Scan(func(key string, value collectionTestUser) bool { return true })
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Scan() = %v, want %v", err, "*DecodeError")
+	}
+}
+
+// Test Delete, Keys and Scan on a typed collection
+func TestTypedCollectionDeleteKeysScan(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	users := TypedCollection[collectionTestUser](db, "users", JSONCodec{})
+	for i, name := range []string{"carol", "alice", "bob"} {
+		err := users.Put(name, collectionTestUser{Name: name, Age: i}, time.Minute)
+		if err != nil {
+			t.Errorf("Put() = %v, want %v", err, "nil")
+		}
+	}
+
+	err := users.Delete("bob")
+	if err != nil {
+		t.Errorf("Delete() = %v, want %v", err, "nil")
+	}
+
+	keys, err := users.Keys()
+	if err != nil {
+		t.Errorf("Keys() = %v, want %v", err, "nil")
+	}
+
+	if !reflect.DeepEqual(keys, []string{"alice", "carol"}) {
+		t.Errorf("Keys() = %v, want %v", keys, []string{"alice", "carol"})
+	}
+
+	var names []string
+	err = users.Scan(func(key string, value collectionTestUser) bool {
+		names = append(names, value.Name)
+		return true
+	})
+	if err != nil {
+		t.Errorf("Scan() = %v, want %v", err, "nil")
+	}
+
+	if !reflect.DeepEqual(names, []string{"alice", "carol"}) {
+		t.Errorf("Scan() = %v, want %v", names, []string{"alice", "carol"})
+	}
+}
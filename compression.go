@@ -0,0 +1,243 @@
+package swmemdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// compressedTag prefixes compressed values. It is followed by the name of
+// the compressor, a zero byte, the uncompressed size as uvarint and the
+// compressed data.
+const compressedTag = "\x00swz1\x00"
+
+// Compressor compresses values. Name identifies the algorithm in stored
+// values and must not contain zero bytes; a database can only decompress
+// values whose compressor is built in or configured.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor compresses values with gzip. A zero Level uses the default
+// compression level.
+type GzipCompressor struct {
+	Level int
+}
+
+// Name returns "gzip".
+func (GzipCompressor) Name() string { return "gzip" }
+
+// Compress compresses data.
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, compressionLevel(c.Level))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses data.
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// FlateCompressor compresses values with DEFLATE. A zero Level uses the
+// default compression level.
+type FlateCompressor struct {
+	Level int
+}
+
+// Name returns "flate".
+func (FlateCompressor) Name() string { return "flate" }
+
+// Compress compresses data.
+func (c FlateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, compressionLevel(c.Level))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses data.
+func (FlateCompressor) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// compressionLevel maps the zero level to the default compression level.
+func compressionLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+
+	return level
+}
+
+// compressionRule describes when values are compressed.
+type compressionRule struct {
+	compressor Compressor
+	minSize    int
+}
+
+// WithCompression compresses values of at least minSize bytes with c before
+// they are stored. Values that do not get smaller are stored as they are.
+// Compressed values are decompressed transparently when read. With
+// encryption enabled, values are compressed before they are encrypted.
+// Indexes cannot order compressed values; disable compression for indexed
+// collections with WithCollectionCompression.
+func WithCompression(c Compressor, minSize int) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.compression = compressionRule{compressor: c, minSize: minSize}
+	}
+}
+
+// WithCollectionCompression overrides WithCompression for a collection. A
+// nil compressor disables compression for the collection.
+func WithCollectionCompression(collection string, c Compressor, minSize int) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		if o.collectionCompression == nil {
+			o.collectionCompression = make(map[string]compressionRule)
+		}
+		o.collectionCompression[collection] = compressionRule{compressor: c, minSize: minSize}
+	}
+}
+
+// compressionRule returns the compression rule of a collection.
+func (db *DB) compressionRule(collection string) compressionRule {
+	if rule, ok := db.opts.collectionCompression[collection]; ok {
+		return rule
+	}
+
+	return db.opts.compression
+}
+
+// compressor returns the compressor with the given name.
+func (db *DB) compressor(name string) (Compressor, error) {
+	if c := db.opts.compression.compressor; c != nil && c.Name() == name {
+		return c, nil
+	}
+
+	for _, rule := range db.opts.collectionCompression {
+		if rule.compressor != nil && rule.compressor.Name() == name {
+			return rule.compressor, nil
+		}
+	}
+
+	switch name {
+	case "gzip":
+		return GzipCompressor{}, nil
+	case "flate":
+		return FlateCompressor{}, nil
+	}
+
+	return nil, fmt.Errorf("swmemdb: unknown compressor %q", name)
+}
+
+// compress compresses a value as configured for its collection.
+func (db *DB) compress(collection, value string) (string, error) {
+	rule := db.compressionRule(collection)
+	if rule.compressor == nil || len(value) < rule.minSize {
+		return value, nil
+	}
+
+	data, err := rule.compressor.Compress([]byte(value))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(compressedTag)
+	b.WriteString(rule.compressor.Name())
+	b.WriteByte(0)
+	b.Write(binary.AppendUvarint(nil, uint64(len(value))))
+	b.Write(data)
+
+	if b.Len() >= len(value) {
+		// not worth it
+		return value, nil
+	}
+
+	return b.String(), nil
+}
+
+// parseCompressed splits a compressed value into the name of its compressor,
+// its uncompressed size and the compressed data. ok is false if the value is
+// not compressed.
+func parseCompressed(value string) (name string, size int, data string, ok bool, err error) {
+	if !strings.HasPrefix(value, compressedTag) {
+		return "", 0, "", false, nil
+	}
+
+	rest := value[len(compressedTag):]
+	i := strings.IndexByte(rest, 0)
+	if i < 0 {
+		return "", 0, "", true, fmt.Errorf("%w: compressed value", ErrCorruptFile)
+	}
+	name, rest = rest[:i], rest[i+1:]
+
+	header := rest
+	if len(header) > binary.MaxVarintLen64 {
+		header = header[:binary.MaxVarintLen64]
+	}
+
+	n, w := binary.Uvarint([]byte(header))
+	if w <= 0 {
+		return "", 0, "", true, fmt.Errorf("%w: compressed value", ErrCorruptFile)
+	}
+
+	return name, int(n), rest[w:], true, nil
+}
+
+// decompress decompresses a value compressed by compress. Other values are
+// returned as they are.
+func (db *DB) decompress(value string) (string, error) {
+	name, _, data, ok, err := parseCompressed(value)
+	if !ok || err != nil {
+		return value, err
+	}
+
+	c, err := db.compressor(name)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := c.Decompress([]byte(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: compressed value: %w", ErrCorruptFile, err)
+	}
+
+	return string(plain), nil
+}
@@ -0,0 +1,175 @@
+package swmemdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// customCompressor is a compressor the database does not know by name.
+type customCompressor struct{}
+
+func (customCompressor) Name() string { return "test" }
+
+func (customCompressor) Compress(data []byte) ([]byte, error) {
+	return FlateCompressor{}.Compress(data)
+}
+
+func (customCompressor) Decompress(data []byte) ([]byte, error) {
+	return FlateCompressor{}.Decompress(data)
+}
+
+// Test compressors round trip values
+func TestCompressors(t *testing.T) {
+	value := []byte(strings.Repeat("hello world ", 100))
+
+	for _, c := range []Compressor{GzipCompressor{}, FlateCompressor{Level: 9}} {
+		data, err := c.Compress(value)
+		if err != nil {
+			t.Fatalf("%s Compress() = %v, want %v", c.Name(), err, "nil")
+		}
+
+		if len(data) >= len(value) {
+			t.Errorf("%s Compress() = %d bytes, want less than %d", c.Name(), len(data), len(value))
+		}
+
+		got, err := c.Decompress(data)
+		if err != nil || !bytes.Equal(got, value) {
+			t.Errorf("%s Decompress() = %v, want %v", c.Name(), err, "original value")
+		}
+	}
+}
+
+// Test WithCompression and WithCollectionCompression
+func TestCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compressed.db")
+	large := strings.Repeat(`{"name":"alice","tags":["a","b","c"]}`, 100)
+
+	db, err := Open(WithMode("file"), WithFile(path),
+		WithCompression(GzipCompressor{}, 64),
+		WithCollectionCompression("logs", customCompressor{}, 16),
+		WithCollectionCompression("raw", nil, 0))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+
+	db.SetToCollection("users", "large", large)
+	db.SetToCollection("users", "small", "tiny")
+	db.SetToCollection("logs", "1", large)
+	db.SetToCollection("raw", "1", large)
+
+	for _, collection := range []string{"users", "logs", "raw"} {
+		value, err := db.GetFromCollection(collection, "large")
+		if collection != "users" {
+			value, err = db.GetFromCollection(collection, "1")
+		}
+		if err != nil || value != large {
+			t.Errorf("GetFromCollection(%s) = %v, want %v", collection, err, "large value")
+		}
+	}
+
+	value, err := db.GetFromCollection("users", "small")
+	if err != nil || value != "tiny" {
+		t.Errorf("GetFromCollection() = %v, %v, want %v", value, err, "tiny")
+	}
+
+	stats, err := db.CollectionStats("users")
+	if err != nil {
+		t.Fatalf("CollectionStats() = %v, want %v", err, "nil")
+	}
+
+	if stats.CompressedKeys != 1 || stats.BytesSaved <= 0 {
+		t.Errorf("CollectionStats() = %+v, want 1 compressed key and saved bytes", stats)
+	}
+
+	stats, _ = db.CollectionStats("raw")
+	if stats.CompressedKeys != 0 || stats.BytesSaved != 0 {
+		t.Errorf("CollectionStats() = %+v, want no compressed keys", stats)
+	}
+
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v, want %v", err, "nil")
+	}
+
+	// only the raw collection holds the plain value
+	if n := bytes.Count(data, []byte(large)); n != 1 {
+		t.Errorf("file contains %d plain values, want %d", n, 1)
+	}
+
+	// values stay readable without compression configured, except for
+	// custom compressors
+	db, err = Open(WithMode("file"), WithFile(path))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	value, err = db.GetFromCollection("users", "large")
+	if err != nil || value != large {
+		t.Errorf("GetFromCollection() = %v, want %v", err, "large value")
+	}
+
+	if _, err := db.GetFromCollection("logs", "1"); err == nil {
+		t.Errorf("GetFromCollection() = %v, want an error", err)
+	}
+}
+
+// Test compression combined with encryption
+func TestCompressionEncryption(t *testing.T) {
+	large := strings.Repeat("compress me ", 100)
+
+	db, err := Open(WithMode("memory"), WithCompression(FlateCompressor{}, 0), WithEncryption(testKey1))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	db.SetToCollection("docs", "1", large)
+
+	value, err := db.GetFromCollection("docs", "1")
+	if err != nil || value != large {
+		t.Errorf("GetFromCollection() = %v, want %v", err, "large value")
+	}
+
+	stats, _ := db.CollectionStats("docs")
+	if stats.CompressedKeys != 1 || stats.ValueBytes >= int64(len(large)) {
+		t.Errorf("CollectionStats() = %+v, want a compressed key", stats)
+	}
+}
+
+// Test collections whose values are compressed cannot be indexed
+func TestCompressionIndex(t *testing.T) {
+	db, err := Open(WithMode("memory"), WithCompression(GzipCompressor{}, 10), WithCollectionCompression("plain", nil, 0))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	if err := db.CreateIndex("users", "age", "age"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("CreateIndex() = %v, want %v", err, ErrInvalidConfig)
+	}
+
+	// collections without compression can be indexed
+	if err := db.CreateIndex("plain", "age", "age"); err != nil {
+		t.Fatalf("CreateIndex() = %v, want %v", err, "nil")
+	}
+
+	db.SetToCollection("plain", "alice", `{"name":"alice","age":30}`)
+	db.SetToCollection("plain", "bob", `{"name":"bob","age":40}`)
+
+	items, err := db.EqualTo("age", 30)
+	if err != nil || len(items) != 1 || items[0].Key != "alice" {
+		t.Errorf("EqualTo() = %v, %v, want %v", items, err, "alice")
+	}
+
+	_, err = Open(WithMode("memory"), WithCompression(GzipCompressor{}, 10), WithIndex("users", "age", "age"))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Open() = %v, want %v", err, ErrInvalidConfig)
+	}
+}
@@ -0,0 +1,166 @@
+package swmemdb
+
+import (
+	"context"
+	"time"
+)
+
+// The methods in this file are variants of the DB methods that take a
+// context. They fail with the error of the context, context.Canceled or
+// context.DeadlineExceeded, if it is done before the write lock is taken or
+// while iterating over keys. The context is passed on to watchers in
+// Event.Context.
+
+// SetCtx is like Set with a context.
+func (db *DB) SetCtx(ctx context.Context, key string, value string, exp time.Duration) error {
+	return db.SetToCollectionCtx(ctx, db.collection, key, value, exp)
+}
+
+// GetCtx is like Get with a context.
+func (db *DB) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return db.GetFromCollectionCtx(ctx, db.collection, key)
+}
+
+// DeleteCtx is like Delete with a context.
+func (db *DB) DeleteCtx(ctx context.Context, key string) error {
+	return db.DeleteFromCollectionCtx(ctx, db.collection, key)
+}
+
+// SetToCollectionCtx is like SetToCollection with a context.
+func (db *DB) SetToCollectionCtx(ctx context.Context, collection string, key string, value string, exps ...time.Duration) error {
+	return db.TxCtx(ctx, func(tx *Tx) error {
+		return tx.Set(collection, key, value, exps...)
+	})
+}
+
+// UpdateToCollectionCtx is like UpdateToCollection with a context.
+func (db *DB) UpdateToCollectionCtx(ctx context.Context, collection string, key string, value string) error {
+	return db.TxCtx(ctx, func(tx *Tx) error {
+		// keep the remaining time to live of the key, if any
+		ttl, err := tx.TTL(collection, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+
+		return tx.set(collection, key, value, expiryOptions(ttl))
+	})
+}
+
+// GetFromCollectionCtx is like GetFromCollection with a context.
+func (db *DB) GetFromCollectionCtx(ctx context.Context, collection string, key string) (interface{}, error) {
+	var value interface{} = ""
+
+	err := db.ViewCtx(ctx, func(tx *Tx) error {
+		val, err := tx.Get(collection, key)
+		if err != nil {
+			return err
+		}
+
+		value = val
+		return nil
+	})
+
+	return value, err
+}
+
+// DeleteFromCollectionCtx is like DeleteFromCollection with a context.
+func (db *DB) DeleteFromCollectionCtx(ctx context.Context, collection string, key string) error {
+	return db.TxCtx(ctx, func(tx *Tx) error {
+		return tx.Delete(collection, key)
+	})
+}
+
+// DeleteWhereCtx is like DeleteWhere with a context. The context is checked
+// before the condition is called for each key, so a long scan can be
+// cancelled; nothing is deleted then.
+func (db *DB) DeleteWhereCtx(ctx context.Context, condition func(key string, value string) bool) error {
+	return db.TxCtx(ctx, func(tx *Tx) error {
+		var delkeys []string
+
+		err := tx.scan(db.collection, func(key, value string) bool {
+			if condition(collectionKey(db.collection, key), value) {
+				delkeys = append(delkeys, key)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range delkeys {
+			// elements of a structure are deleted with it
+			if err := tx.Delete(db.collection, k); err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetKeysCtx is like GetKeys with a context.
+func (db *DB) GetKeysCtx(ctx context.Context) ([]string, error) {
+	return db.GetKeysFromCollectionCtx(ctx, db.collection)
+}
+
+// GetKeysFromCollectionCtx is like GetKeysFromCollection with a context.
+// Values are not decoded.
+func (db *DB) GetKeysFromCollectionCtx(ctx context.Context, collection string) ([]string, error) {
+	var keys []string
+
+	err := db.ViewCtx(ctx, func(tx *Tx) error {
+		var err error
+
+		iterErr := tx.tx.AscendKeys(collectionPattern(collection), func(key, value string) bool {
+			if err = tx.ctx.Err(); err != nil {
+				return false
+			}
+
+			// strip the collection name
+			key = key[len(collection)+1:]
+			if !isElementKey(key) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if iterErr != nil {
+			return iterErr
+		}
+
+		return err
+	})
+
+	return keys, err
+}
+
+// ScanCtx calls fn for every key/value pair of a collection in key order
+// until fn returns false.
+func (db *DB) ScanCtx(ctx context.Context, collection string, fn func(key, value string) bool) error {
+	return db.ViewCtx(ctx, func(tx *Tx) error {
+		return tx.scan(collection, fn)
+	})
+}
+
+// scan calls fn for every decoded key/value pair of a collection until fn
+// returns false, checking the context of the transaction before each call.
+// The elements of structures are skipped.
+func (tx *Tx) scan(collection string, fn func(key, value string) bool) error {
+	var err error
+
+	iterErr := tx.tx.AscendKeys(collectionPattern(collection), tx.db.decodeIterator(len(collection)+1, &err, func(key, value string) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+
+		if isElementKey(key) {
+			return true
+		}
+
+		return fn(key, value)
+	}))
+	if iterErr != nil {
+		return iterErr
+	}
+
+	return err
+}
@@ -0,0 +1,214 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// Test the context variants with a live context
+func TestContextVariants(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if err := db.SetCtx(ctx, "a", "1", 0); err != nil {
+		t.Errorf("SetCtx() = %v, want %v", err, "nil")
+	}
+
+	if value, err := db.GetCtx(ctx, "a"); err != nil || value != "1" {
+		t.Errorf("GetCtx() = %v, %v, want %v", value, err, "1")
+	}
+
+	db.SetToCollectionCtx(ctx, "users", "alice", "1", time.Hour)
+	db.UpdateToCollectionCtx(ctx, "users", "alice", "2")
+	db.SetToCollectionCtx(ctx, "users", "bob", "3")
+
+	if value, err := db.GetFromCollectionCtx(ctx, "users", "alice"); err != nil || value != "2" {
+		t.Errorf("GetFromCollectionCtx() = %v, %v, want %v", value, err, "2")
+	}
+
+	if ttl, _ := db.TTLInCollection("users", "alice"); ttl <= 0 {
+		t.Errorf("TTLInCollection() = %v, want > 0", ttl)
+	}
+
+	keys, err := db.GetKeysFromCollectionCtx(ctx, "users")
+	if want := []string{"alice", "bob"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollectionCtx() = %v, %v, want %v", keys, err, want)
+	}
+
+	if err := db.DeleteFromCollectionCtx(ctx, "users", "bob"); err != nil {
+		t.Errorf("DeleteFromCollectionCtx() = %v, want %v", err, "nil")
+	}
+
+	if _, err := db.GetFromCollectionCtx(ctx, "users", "bob"); err != ErrNotFound {
+		t.Errorf("GetFromCollectionCtx() = %v, want %v", err, ErrNotFound)
+	}
+
+	db.SetCtx(ctx, "b", "2", 0)
+	err = db.DeleteWhereCtx(ctx, func(key, value string) bool {
+		return key == "testtable:a"
+	})
+	if err != nil {
+		t.Errorf("DeleteWhereCtx() = %v, want %v", err, "nil")
+	}
+
+	keys, _ = db.GetKeysCtx(ctx)
+	if want := []string{"b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysCtx() = %v, want %v", keys, want)
+	}
+
+	if err := db.DeleteCtx(ctx, "b"); err != nil {
+		t.Errorf("DeleteCtx() = %v, want %v", err, "nil")
+	}
+}
+
+// Test listing keys does not decode the values
+func TestGetKeysCtxUndecodable(t *testing.T) {
+	db, err := Open(WithMode("memory"), WithEncryption(testKey1))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	// a value that cannot be decrypted
+	db.db.Update(func(tx *bunt.Tx) error {
+		_, _, err := tx.Set("users:alice", encryptedTag+"garbage", nil)
+		return err
+	})
+
+	if _, err := db.GetFromCollection("users", "alice"); err == nil {
+		t.Errorf("GetFromCollection() = %v, want an error", err)
+	}
+
+	keys, err := db.GetKeysFromCollectionCtx(context.Background(), "users")
+	if want := []string{"alice"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollectionCtx() = %v, %v, want %v", keys, err, want)
+	}
+}
+
+// Test the context variants fail with a done context
+func TestContextCanceled(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.SetToCollection("users", "alice", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := db.SetToCollectionCtx(ctx, "users", "bob", "2"); err != context.Canceled {
+		t.Errorf("SetToCollectionCtx() = %v, want %v", err, context.Canceled)
+	}
+
+	if _, err := db.GetFromCollectionCtx(ctx, "users", "alice"); err != context.Canceled {
+		t.Errorf("GetFromCollectionCtx() = %v, want %v", err, context.Canceled)
+	}
+
+	deadline, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if _, err := db.GetKeysFromCollectionCtx(deadline, "users"); err != context.DeadlineExceeded {
+		t.Errorf("GetKeysFromCollectionCtx() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if _, err := db.GetFromCollection("users", "bob"); err != ErrNotFound {
+		t.Errorf("GetFromCollection() = %v, want %v", err, ErrNotFound)
+	}
+}
+
+// Test cancelling a scan part way
+func TestScanCtxCancel(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		db.Set(strconv.Itoa(i), "x", 0)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var seen int
+	err := db.ScanCtx(ctx, "testtable", func(key, value string) bool {
+		seen++
+		if seen == 10 {
+			cancel()
+		}
+		return true
+	})
+	if err != context.Canceled || seen != 10 {
+		t.Errorf("ScanCtx() = %v after %d keys, want %v after %d", err, seen, context.Canceled, 10)
+	}
+
+	// a cancelled DeleteWhereCtx deletes nothing
+	ctx, cancel = context.WithCancel(context.Background())
+	var calls int
+	err = db.DeleteWhereCtx(ctx, func(key, value string) bool {
+		calls++
+		if calls == 50 {
+			cancel()
+		}
+		return true
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteWhereCtx() = %v, want %v", err, context.Canceled)
+	}
+
+	if keys, _ := db.GetKeys(); len(keys) != 100 {
+		t.Errorf("GetKeys() = %d keys, want %d", len(keys), 100)
+	}
+}
+
+// Test the context of a transaction reaches watchers and the transaction
+func TestContextEvents(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	type traceKey struct{}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := db.Watch(watchCtx, "users", WatchOptions{Buffer: 10})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-1")
+	err = db.TxCtx(ctx, func(tx *Tx) error {
+		if got := tx.Context().Value(traceKey{}); got != "trace-1" {
+			t.Errorf("Context().Value() = %v, want %v", got, "trace-1")
+		}
+		return tx.Set("users", "alice", "1")
+	})
+	if err != nil {
+		t.Fatalf("TxCtx() = %v, want %v", err, "nil")
+	}
+
+	select {
+	case ev := <-events:
+		if got := ev.Context.Value(traceKey{}); got != "trace-1" {
+			t.Errorf("Event.Context.Value() = %v, want %v", got, "trace-1")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event")
+	}
+
+	db.SetToCollection("users", "bob", "2")
+
+	select {
+	case ev := <-events:
+		if ev.Context == nil || ev.Context.Value(traceKey{}) != nil {
+			t.Errorf("Event.Context = %v, want %v", ev.Context, context.Background())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event")
+	}
+}
@@ -0,0 +1,140 @@
+package swmemdb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Incr atomically adds delta to the integer value of a key and returns the
+// new value. A missing key is created with the value delta and the optional
+// expiration; the expiration of an existing key is kept. Fails with
+// ErrNotNumber if the value is not an integer and with ErrOverflow if the
+// result does not fit into an int64.
+func (db *DB) Incr(key string, delta int64, exps ...time.Duration) (int64, error) {
+	return db.IncrInCollection(db.collection, key, delta, exps...)
+}
+
+// Decr atomically subtracts delta from the integer value of a key, see Incr.
+func (db *DB) Decr(key string, delta int64, exps ...time.Duration) (int64, error) {
+	return db.DecrInCollection(db.collection, key, delta, exps...)
+}
+
+// IncrFloat atomically adds delta to the floating point value of a key and
+// returns the new value, see Incr.
+func (db *DB) IncrFloat(key string, delta float64, exps ...time.Duration) (float64, error) {
+	return db.IncrFloatInCollection(db.collection, key, delta, exps...)
+}
+
+// IncrInCollection is like Incr for a key in a collection.
+func (db *DB) IncrInCollection(collection, key string, delta int64, exps ...time.Duration) (int64, error) {
+	var value int64
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		value, err = tx.Incr(collection, key, delta, exps...)
+		return err
+	})
+
+	return value, err
+}
+
+// DecrInCollection is like Decr for a key in a collection.
+func (db *DB) DecrInCollection(collection, key string, delta int64, exps ...time.Duration) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+
+	return db.IncrInCollection(collection, key, -delta, exps...)
+}
+
+// IncrFloatInCollection is like IncrFloat for a key in a collection.
+func (db *DB) IncrFloatInCollection(collection, key string, delta float64, exps ...time.Duration) (float64, error) {
+	var value float64
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		value, err = tx.IncrFloat(collection, key, delta, exps...)
+		return err
+	})
+
+	return value, err
+}
+
+// Incr adds delta to the integer value of a key in a collection, see
+// DB.Incr.
+func (tx *Tx) Incr(collection, key string, delta int64, exps ...time.Duration) (int64, error) {
+	var value int64
+
+	err := tx.modify(collection, key, exps, func(current string, exists bool) (string, error) {
+		if exists {
+			n, err := strconv.ParseInt(current, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("%w: %s: %q", ErrNotNumber, key, current)
+			}
+
+			if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+				return "", ErrOverflow
+			}
+			value = n
+		}
+
+		value += delta
+		return strconv.FormatInt(value, 10), nil
+	})
+
+	return value, err
+}
+
+// IncrFloat adds delta to the floating point value of a key in a
+// collection, see DB.IncrFloat.
+func (tx *Tx) IncrFloat(collection, key string, delta float64, exps ...time.Duration) (float64, error) {
+	var value float64
+
+	err := tx.modify(collection, key, exps, func(current string, exists bool) (string, error) {
+		if exists {
+			f, err := strconv.ParseFloat(current, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return "", fmt.Errorf("%w: %s: %q", ErrNotNumber, key, current)
+			}
+			value = f
+		}
+
+		value += delta
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return "", ErrOverflow
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	})
+
+	return value, err
+}
+
+// modify replaces the value of a key in a collection by the result of fn,
+// keeping its expiration. A missing key is created with the given
+// expiration.
+func (tx *Tx) modify(collection, key string, exps []time.Duration, fn func(current string, exists bool) (string, error)) error {
+	current, err := tx.get(collection, key)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	exists := err == nil
+
+	value, err := fn(current, exists)
+	if err != nil {
+		return err
+	}
+
+	var exp time.Duration
+	if exists {
+		// keep the remaining time to live of the key
+		if exp, err = tx.TTL(collection, key); err != nil {
+			return err
+		}
+	} else if len(exps) > 0 {
+		exp = exps[0]
+	}
+
+	return tx.set(collection, key, value, expiryOptions(exp))
+}
@@ -0,0 +1,119 @@
+package swmemdb
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test Incr and Decr
+func TestIncr(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	if n, err := db.Incr("hits", 1); err != nil || n != 1 {
+		t.Errorf("Incr() = %v, %v, want %v", n, err, 1)
+	}
+
+	if n, err := db.Incr("hits", 5); err != nil || n != 6 {
+		t.Errorf("Incr() = %v, %v, want %v", n, err, 6)
+	}
+
+	if n, err := db.Decr("hits", 10); err != nil || n != -4 {
+		t.Errorf("Decr() = %v, %v, want %v", n, err, -4)
+	}
+
+	if value, _ := db.Get("hits"); value != "-4" {
+		t.Errorf("Get() = %v, want %v", value, "-4")
+	}
+
+	db.Set("name", "alice", 0)
+	if _, err := db.Incr("name", 1); !errors.Is(err, ErrNotNumber) {
+		t.Errorf("Incr() = %v, want %v", err, ErrNotNumber)
+	}
+
+	db.Set("max", "9223372036854775807", 0)
+	if _, err := db.Incr("max", 1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Incr() = %v, want %v", err, ErrOverflow)
+	}
+
+	if _, err := db.Decr("min", math.MinInt64); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Decr() = %v, want %v", err, ErrOverflow)
+	}
+}
+
+// Test the expiration is only set when the key is created
+func TestIncrTTL(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.IncrInCollection("counters", "a", 1, time.Hour)
+	db.IncrInCollection("counters", "a", 1, time.Second)
+
+	ttl, _ := db.TTLInCollection("counters", "a")
+	if ttl <= time.Minute {
+		t.Errorf("TTLInCollection() = %v, want about %v", ttl, time.Hour)
+	}
+
+	db.IncrInCollection("counters", "b", 1)
+	if ttl, _ := db.TTLInCollection("counters", "b"); ttl != NoExpiration {
+		t.Errorf("TTLInCollection() = %v, want %v", ttl, NoExpiration)
+	}
+}
+
+// Test IncrFloat
+func TestIncrFloat(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	if f, err := db.IncrFloatInCollection("counters", "f", 1.5); err != nil || f != 1.5 {
+		t.Errorf("IncrFloatInCollection() = %v, %v, want %v", f, err, 1.5)
+	}
+
+	if f, err := db.IncrFloatInCollection("counters", "f", -0.25); err != nil || f != 1.25 {
+		t.Errorf("IncrFloatInCollection() = %v, %v, want %v", f, err, 1.25)
+	}
+
+	if value, _ := db.GetFromCollection("counters", "f"); value != "1.25" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "1.25")
+	}
+
+	// integers can be incremented as floats
+	db.IncrInCollection("counters", "i", 3)
+	if f, err := db.IncrFloatInCollection("counters", "i", 0.5); err != nil || f != 3.5 {
+		t.Errorf("IncrFloatInCollection() = %v, %v, want %v", f, err, 3.5)
+	}
+
+	if _, err := db.IncrFloatInCollection("counters", "f", math.Inf(1)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("IncrFloatInCollection() = %v, want %v", err, ErrOverflow)
+	}
+
+	db.SetToCollection("counters", "s", "x")
+	if _, err := db.IncrFloatInCollection("counters", "s", 1); !errors.Is(err, ErrNotNumber) {
+		t.Errorf("IncrFloatInCollection() = %v, want %v", err, ErrNotNumber)
+	}
+}
+
+// Test concurrent increments do not lose updates
+func TestIncrConcurrent(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				db.IncrInCollection("counters", "n", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, _ := db.GetFromCollection("counters", "n"); value != "1000" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "1000")
+	}
+}
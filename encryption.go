@@ -0,0 +1,270 @@
+package swmemdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+const (
+	// encryptedTag prefixes encrypted values.
+	encryptedTag = "\x00swenc1\x00"
+	// encryptionCheckKey holds a known value encrypted with the current key,
+	// used to detect a wrong key when the database is opened.
+	encryptionCheckKey = metaCollection + ":encryption"
+	// encryptionCheckValue is the plain value of encryptionCheckKey.
+	encryptionCheckValue = "swmemdb"
+)
+
+// WithEncryption encrypts all values with AES-GCM before they are stored.
+// The key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or
+// AES-256. Keys are not encrypted, since collections, ordering and patterns
+// depend on them. Indexes cannot order encrypted values, so creating an
+// index on an encrypted database fails with ErrInvalidConfig.
+//
+// Opening a database with a different key than it was written with fails
+// with ErrWrongKey. Values stored before encryption was enabled stay
+// readable; use RotateEncryptionKey to encrypt them.
+func WithEncryption(key []byte) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.encryptionKey = key
+	}
+}
+
+// valueCipher encrypts and decrypts values.
+type valueCipher struct {
+	aead cipher.AEAD
+}
+
+// newValueCipher returns a cipher for key, or nil if key is empty.
+func newValueCipher(key []byte) (*valueCipher, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	return &valueCipher{aead: aead}, nil
+}
+
+// encrypt encrypts a value with a random nonce.
+func (c *valueCipher) encrypt(value string) string {
+	buf := make([]byte, len(encryptedTag), len(encryptedTag)+c.aead.NonceSize()+len(value)+c.aead.Overhead())
+	copy(buf, encryptedTag)
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	buf = append(buf, nonce...)
+
+	return string(c.aead.Seal(buf, nonce, []byte(value), nil))
+}
+
+// decrypt decrypts a stored value with c. Values that were stored without
+// encryption are returned as they are.
+func decrypt(c *valueCipher, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedTag) {
+		return stored, nil
+	}
+
+	if c == nil {
+		return "", ErrWrongKey
+	}
+
+	data := stored[len(encryptedTag):]
+	if len(data) < c.aead.NonceSize() {
+		return "", ErrWrongKey
+	}
+
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	value, err := c.aead.Open(nil, []byte(nonce), []byte(ciphertext), nil)
+	if err != nil {
+		return "", ErrWrongKey
+	}
+
+	return string(value), nil
+}
+
+// checkEncryption verifies that c is the key bdb was written with. The
+// check value is written if the database has none yet.
+func checkEncryption(bdb *bunt.DB, c *valueCipher) error {
+	return bdb.Update(func(tx *bunt.Tx) error {
+		stored, err := tx.Get(encryptionCheckKey)
+		if err == ErrNotFound {
+			if c == nil {
+				return nil
+			}
+
+			_, _, err := tx.Set(encryptionCheckKey, c.encrypt(encryptionCheckValue), nil)
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		value, err := decrypt(c, stored)
+		if err != nil {
+			return err
+		}
+
+		if value != encryptionCheckValue {
+			return ErrWrongKey
+		}
+
+		return nil
+	})
+}
+
+// RotateEncryptionKey re-encrypts every value of the database, written with
+// oldKey, with newKey in a single transaction. An empty oldKey reads plain
+// values, e.g. to encrypt a database for the first time, and an empty newKey
+// stores all values in plain text. Fails with ErrWrongKey if oldKey is not
+// the current key, and with ErrInvalidConfig when encrypting a database
+// with indexes. In file mode the file is rewritten afterwards, so it no
+// longer holds the values as they were before. The re-encrypted values are
+// sent to replicas, which must be reopened with newKey to read them.
+func (db *DB) RotateEncryptionKey(oldKey, newKey []byte) error {
+	oldCipher, err := newValueCipher(oldKey)
+	if err != nil {
+		return err
+	}
+
+	newCipher, err := newValueCipher(newKey)
+	if err != nil {
+		return err
+	}
+
+	// keep indexes from being created while switching keys
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if newCipher != nil && len(db.opts.indexes) > 0 {
+		return fmt.Errorf("%w: indexes cannot order encrypted values", ErrInvalidConfig)
+	}
+
+	current := db.cipher.Load()
+
+	err = db.Tx(func(tx *Tx) error {
+		if err := checkTxEncryption(tx.tx, oldCipher); err != nil {
+			return err
+		}
+
+		type entry struct {
+			key, value string
+		}
+
+		var entries []entry
+		var decodeErr error
+		err := tx.tx.Ascend("", func(key, stored string) bool {
+			if key == encryptionCheckKey {
+				return true
+			}
+
+			value, err := decrypt(oldCipher, stored)
+			if err != nil {
+				decodeErr = err
+				return false
+			}
+
+			entries = append(entries, entry{key: key, value: value})
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if decodeErr != nil {
+			return decodeErr
+		}
+
+		for _, e := range entries {
+			ttl, err := tx.tx.TTL(e.key)
+			if err == ErrNotFound {
+				// expired
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			stored := e.value
+			if newCipher != nil {
+				stored = newCipher.encrypt(e.value)
+			}
+
+			// the values do not change, so nothing is reported to watchers
+			opts := expiryOptions(ttl)
+			if _, _, err := tx.tx.Set(e.key, stored, opts); err != nil {
+				return err
+			}
+			tx.replicateSet(e.key, stored, opts)
+		}
+
+		if newCipher == nil {
+			if _, err := tx.tx.Delete(encryptionCheckKey); err == nil {
+				tx.replicate(mutation{Type: EventDelete, Key: encryptionCheckKey})
+			} else if err != ErrNotFound {
+				return err
+			}
+		} else {
+			stored := newCipher.encrypt(encryptionCheckValue)
+			if _, _, err := tx.tx.Set(encryptionCheckKey, stored, nil); err != nil {
+				return err
+			}
+			tx.replicateSet(encryptionCheckKey, stored, nil)
+		}
+
+		// switch keys before other writers can take the lock
+		db.cipher.Store(newCipher)
+		return nil
+	})
+	if err != nil {
+		db.cipher.Store(current)
+		return err
+	}
+
+	// reopen with the new key
+	db.opts.encryptionKey = newKey
+
+	// rewrite the file, which still holds the values as they were before
+	if memory, _ := parseMode(db.mode); !memory {
+		return db.db.Shrink()
+	}
+
+	return nil
+}
+
+// checkTxEncryption verifies that c is the key the database was written
+// with, inside a transaction.
+func checkTxEncryption(tx *bunt.Tx, c *valueCipher) error {
+	stored, err := tx.Get(encryptionCheckKey)
+	if err == ErrNotFound {
+		if c != nil {
+			return ErrWrongKey
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	value, err := decrypt(c, stored)
+	if err != nil {
+		return err
+	}
+
+	if value != encryptionCheckValue {
+		return ErrWrongKey
+	}
+
+	return nil
+}
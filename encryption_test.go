@@ -0,0 +1,225 @@
+package swmemdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+// Test values are encrypted in the database file
+func TestEncryptionFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enc.db")
+
+	db, err := Open(WithMode("file"), WithFile(path), WithEncryption(testKey1))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+
+	if err := db.SetToCollection("users", "alice", "top secret"); err != nil {
+		t.Fatalf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	value, err := db.GetFromCollection("users", "alice")
+	if err != nil || value != "top secret" {
+		t.Errorf("GetFromCollection() = %v, %v, want %v", value, err, "top secret")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() = %v, want %v", err, "nil")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v, want %v", err, "nil")
+	}
+
+	if bytes.Contains(data, []byte("top secret")) {
+		t.Errorf("file contains plain value")
+	}
+
+	if !bytes.Contains(data, []byte("alice")) {
+		t.Errorf("file does not contain key")
+	}
+
+	// reopen with the same key
+	db, err = Open(WithMode("file"), WithFile(path), WithEncryption(testKey1))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	value, err = db.GetFromCollection("users", "alice")
+	if err != nil || value != "top secret" {
+		t.Errorf("GetFromCollection() = %v, %v, want %v", value, err, "top secret")
+	}
+
+	names, err := db.ListCollections()
+	if err != nil || len(names) != 1 || names[0] != "users" {
+		t.Errorf("ListCollections() = %v, %v, want %v", names, err, []string{"users"})
+	}
+}
+
+// Test opening an encrypted database with a wrong key or without a key
+func TestEncryptionWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enc.db")
+
+	db, err := Open(WithMode("file"), WithFile(path), WithEncryption(testKey1))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	db.SetToCollection("users", "alice", "1")
+	db.Close()
+
+	_, err = Open(WithMode("file"), WithFile(path), WithEncryption(testKey2))
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open() = %v, want %v", err, ErrWrongKey)
+	}
+
+	_, err = Open(WithMode("file"), WithFile(path))
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open() = %v, want %v", err, ErrWrongKey)
+	}
+}
+
+// Test WithEncryption with an invalid key length
+func TestEncryptionInvalidKey(t *testing.T) {
+	_, err := Open(WithMode("memory"), WithEncryption([]byte("short")))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Open() = %v, want %v", err, ErrInvalidConfig)
+	}
+}
+
+// Test RotateEncryptionKey
+func TestRotateEncryptionKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enc.db")
+
+	// start without encryption
+	db, err := Open(WithMode("file"), WithFile(path))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	db.SetToCollection("users", "alice", "1")
+	db.SetToCollection("users", "bob", "2", time.Hour)
+
+	if err := db.RotateEncryptionKey(testKey1, testKey2); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("RotateEncryptionKey() = %v, want %v", err, ErrWrongKey)
+	}
+
+	if err := db.RotateEncryptionKey(nil, testKey1); err != nil {
+		t.Fatalf("RotateEncryptionKey() = %v, want %v", err, "nil")
+	}
+
+	if err := db.RotateEncryptionKey(testKey1, testKey2); err != nil {
+		t.Fatalf("RotateEncryptionKey() = %v, want %v", err, "nil")
+	}
+
+	value, err := db.GetFromCollection("users", "bob")
+	if err != nil || value != "2" {
+		t.Errorf("GetFromCollection() = %v, %v, want %v", value, err, "2")
+	}
+
+	ttl, err := db.TTLInCollection("users", "bob")
+	if err != nil || ttl <= 0 {
+		t.Errorf("TTLInCollection() = %v, %v, want > 0", ttl, err)
+	}
+	db.Close()
+
+	_, err = Open(WithMode("file"), WithFile(path), WithEncryption(testKey1))
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open() = %v, want %v", err, ErrWrongKey)
+	}
+
+	db, err = Open(WithMode("file"), WithFile(path), WithEncryption(testKey2))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	value, err = db.GetFromCollection("users", "alice")
+	if err != nil || value != "1" {
+		t.Errorf("GetFromCollection() = %v, %v, want %v", value, err, "1")
+	}
+
+	// back to plain text
+	if err := db.RotateEncryptionKey(testKey2, nil); err != nil {
+		t.Fatalf("RotateEncryptionKey() = %v, want %v", err, "nil")
+	}
+
+	var buf bytes.Buffer
+	if err := db.Backup(&buf); err != nil {
+		t.Fatalf("Backup() = %v, want %v", err, "nil")
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte("alice")) || bytes.Contains(buf.Bytes(), []byte(encryptedTag)) {
+		t.Errorf("Backup() contains encrypted values")
+	}
+}
+
+// Test encrypted databases cannot be indexed
+func TestEncryptionIndex(t *testing.T) {
+	_, err := Open(WithMode("memory"), WithEncryption(testKey1), WithIndex("users", "age", "age"))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Open() = %v, want %v", err, ErrInvalidConfig)
+	}
+
+	db, err := Open(WithMode("memory"), WithEncryption(testKey1))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+
+	if err := db.CreateIndex("users", "age", "age"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("CreateIndex() = %v, want %v", err, ErrInvalidConfig)
+	}
+	db.Close()
+
+	// indexed databases cannot be encrypted
+	db, err = Open(WithMode("memory"), WithIndex("users", "age", "age"))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	defer db.Close()
+
+	db.SetToCollection("users", "alice", `{"age":20}`)
+
+	if err := db.RotateEncryptionKey(nil, testKey1); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("RotateEncryptionKey() = %v, want %v", err, ErrInvalidConfig)
+	}
+
+	items, err := db.EqualTo("age", 20)
+	if err != nil || len(items) != 1 {
+		t.Errorf("EqualTo() = %v, %v, want %v", items, err, "alice")
+	}
+}
+
+// Test rotating the key leaves no old values in the database file
+func TestRotateEncryptionKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	db, err := Open(WithMode("file"), WithFile(path))
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+	db.SetToCollection("tokens", "alice", "secret-token")
+
+	if err := db.RotateEncryptionKey(nil, testKey1); err != nil {
+		t.Fatalf("RotateEncryptionKey() = %v, want %v", err, "nil")
+	}
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v, want %v", err, "nil")
+	}
+
+	if bytes.Contains(data, []byte("secret-token")) {
+		t.Errorf("ReadFile() = %q, want no plain values", data)
+	}
+}
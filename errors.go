@@ -0,0 +1,74 @@
+package swmemdb
+
+import (
+	"errors"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+var (
+	// ErrNotFound is returned when a key does not exist or has expired. It is
+	// the same error the underlying database returns, so both can be matched.
+	ErrNotFound = bunt.ErrNotFound
+
+	// ErrInvalidMode is returned when the configured mode is empty.
+	ErrInvalidMode = errors.New("swmemdb: invalid mode")
+
+	// ErrOpenFile is returned when the database file cannot be opened or
+	// created.
+	ErrOpenFile = errors.New("swmemdb: cannot open file")
+
+	// ErrCorruptFile is returned when the database file exists but its
+	// contents cannot be loaded.
+	ErrCorruptFile = errors.New("swmemdb: corrupt file")
+
+	// ErrInvalidConfig is returned when the configuration is rejected by the
+	// underlying database, e.g. an unknown sync policy.
+	ErrInvalidConfig = errors.New("swmemdb: invalid config")
+
+	// ErrCollectionNotFound is returned when a collection holds no keys.
+	ErrCollectionNotFound = errors.New("swmemdb: collection not found")
+
+	// ErrCollectionExists is returned when a collection would overwrite
+	// another collection that already holds keys.
+	ErrCollectionExists = errors.New("swmemdb: collection exists")
+
+	// ErrConflict is returned by Import when a key already exists and the
+	// conflict policy is ConflictFail.
+	ErrConflict = errors.New("swmemdb: key exists")
+
+	// ErrWrongKey is returned when values cannot be decrypted, because the
+	// database was written with a different encryption key or none was
+	// given.
+	ErrWrongKey = errors.New("swmemdb: wrong encryption key")
+
+	// ErrReadOnly is returned when writing to a replica.
+	ErrReadOnly = errors.New("swmemdb: read-only replica")
+
+	// ErrNotNumber is returned when incrementing a value that is not a
+	// number.
+	ErrNotNumber = errors.New("swmemdb: value is not a number")
+
+	// ErrOverflow is returned when an increment would overflow.
+	ErrOverflow = errors.New("swmemdb: increment would overflow")
+
+	// ErrWrongType is returned when a hash, list or set operation is used on
+	// a key holding another kind of value.
+	ErrWrongType = errors.New("swmemdb: value has the wrong type")
+
+	// ErrLeaseHeld is returned when acquiring a lease that is held by
+	// another owner.
+	ErrLeaseHeld = errors.New("swmemdb: lease held by another owner")
+
+	// ErrLeaseLost is returned when renewing or releasing a lease that
+	// expired or was acquired by another owner in the meantime.
+	ErrLeaseLost = errors.New("swmemdb: lease lost")
+
+	// ErrLoadFailed is returned by GetOrLoad for a key whose last load
+	// failed and whose error is cached.
+	ErrLoadFailed = errors.New("swmemdb: load failed")
+
+	// ErrJobLost is returned when acknowledging a job that was dequeued
+	// again after its visibility timeout expired, or that no longer exists.
+	ErrJobLost = errors.New("swmemdb: job lost")
+)
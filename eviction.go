@@ -0,0 +1,380 @@
+package swmemdb
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// EvictionPolicy selects the keys that are evicted when a limit is exceeded.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used keys.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU evicts the least frequently used keys.
+	EvictLFU
+	// EvictTTL evicts the keys that expire soonest. Keys without an
+	// expiration are evicted least recently used first once no expiring
+	// keys are left.
+	EvictTTL
+	// EvictRandom evicts random keys.
+	EvictRandom
+)
+
+// RemovalReason tells why keys were removed without being deleted.
+type RemovalReason int
+
+const (
+	// RemovedExpired is reported for keys that expired.
+	RemovedExpired RemovalReason = iota
+	// RemovedEvicted is reported for keys that were evicted to stay within a
+	// limit.
+	RemovedEvicted
+)
+
+// String returns the name of the reason.
+func (r RemovalReason) String() string {
+	switch r {
+	case RemovedExpired:
+		return "expired"
+	case RemovedEvicted:
+		return "evicted"
+	}
+
+	return "unknown"
+}
+
+// evictionSamples is the number of keys sampled to pick each evicted key.
+// Like Redis, eviction picks the best candidate of a sample rather than
+// ordering all keys, which approximates the policy.
+const evictionSamples = 16
+
+// limits bounds the number of keys and the memory of a collection or the
+// whole database. Zero values are unlimited.
+type limits struct {
+	maxKeys   int
+	maxMemory int64
+}
+
+// WithMaxKeys limits the number of keys of the database. Once exceeded,
+// keys are evicted as selected by the eviction policy.
+func WithMaxKeys(n int) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.limits.maxKeys = n
+	}
+}
+
+// WithMaxMemory limits the memory used by the keys and values of the
+// database to the given number of bytes. Once exceeded, keys are evicted as
+// selected by the eviction policy. The memory of a key is the size of its
+// key and stored value; index and bookkeeping overhead is not counted.
+func WithMaxMemory(bytes int64) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.limits.maxMemory = bytes
+	}
+}
+
+// WithCollectionLimits limits the number of keys and the memory of a
+// collection. A zero limit is unlimited.
+func WithCollectionLimits(collection string, maxKeys int, maxMemory int64) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		if o.collectionLimits == nil {
+			o.collectionLimits = make(map[string]limits)
+		}
+		o.collectionLimits[collection] = limits{maxKeys: maxKeys, maxMemory: maxMemory}
+	}
+}
+
+// WithEvictionPolicy sets the eviction policy, EvictLRU by default. Each
+// evicted key is the best candidate of a small random sample of keys, so
+// policies are followed approximately once there are more keys than the
+// sample holds.
+func WithEvictionPolicy(policy EvictionPolicy) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.evictionPolicy = policy
+	}
+}
+
+// WithOnRemoved sets a callback for keys that were removed because they
+// expired or were evicted. It is called after the keys have been removed.
+func WithOnRemoved(onRemoved func(keys []string, reason RemovalReason)) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.onRemoved = onRemoved
+	}
+}
+
+// limited reports whether any limit is configured.
+func (o *buntDbOptions) limited() bool {
+	return o.limits != (limits{}) || len(o.collectionLimits) > 0
+}
+
+// keyUsage tracks the size and use of a key.
+type keyUsage struct {
+	size       int64
+	lastAccess uint64
+	hits       uint64
+	expiresAt  time.Time
+}
+
+// usageChange is a change of a key recorded by a transaction.
+type usageChange struct {
+	key       string
+	deleted   bool
+	size      int64
+	expiresAt time.Time
+}
+
+// collectionUsage is the number of keys and bytes of a collection.
+type collectionUsage struct {
+	keys  int
+	bytes int64
+	// members are the keys of the collection, nil for the whole database
+	members map[string]*keyUsage
+}
+
+// usage tracks the keys of a database for eviction.
+type usage struct {
+	mu          sync.Mutex
+	keys        map[string]*keyUsage
+	total       collectionUsage
+	collections map[string]*collectionUsage
+	clock       uint64
+}
+
+// reset tracks the keys stored in bdb.
+func (u *usage) reset(bdb *bunt.DB) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.keys = make(map[string]*keyUsage)
+	u.total = collectionUsage{}
+	u.collections = make(map[string]*collectionUsage)
+
+	return bdb.View(func(tx *bunt.Tx) error {
+		now := time.Now()
+
+		var err error
+		tx.Ascend("", func(key, value string) bool {
+			var ttl time.Duration
+			if ttl, err = tx.TTL(key); err == ErrNotFound {
+				// expired
+				err = nil
+				return true
+			} else if err != nil {
+				return false
+			}
+
+			change := usageChange{key: key, size: int64(len(key) + len(value))}
+			if ttl > 0 {
+				change.expiresAt = now.Add(ttl)
+			}
+			u.apply(change)
+			return true
+		})
+		return err
+	})
+}
+
+// apply applies a committed change. u.mu must be held.
+func (u *usage) apply(c usageChange) {
+	collection, _ := splitKey(c.key)
+	if collection == metaCollection {
+		return
+	}
+
+	cu := u.collections[collection]
+	if cu == nil {
+		cu = &collectionUsage{members: make(map[string]*keyUsage)}
+		u.collections[collection] = cu
+	}
+
+	if k, ok := u.keys[c.key]; ok {
+		u.total.keys--
+		u.total.bytes -= k.size
+		cu.keys--
+		cu.bytes -= k.size
+		if c.deleted {
+			delete(u.keys, c.key)
+			delete(cu.members, c.key)
+			return
+		}
+
+		u.clock++
+		k.size, k.expiresAt, k.lastAccess = c.size, c.expiresAt, u.clock
+		k.hits++
+	} else if c.deleted {
+		return
+	} else {
+		u.clock++
+		k := &keyUsage{size: c.size, expiresAt: c.expiresAt, lastAccess: u.clock, hits: 1}
+		u.keys[c.key] = k
+		cu.members[c.key] = k
+	}
+
+	u.total.keys++
+	u.total.bytes += c.size
+	cu.keys++
+	cu.bytes += c.size
+}
+
+// commit applies the changes of a committed transaction.
+func (u *usage) commit(changes []usageChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, c := range changes {
+		u.apply(c)
+	}
+}
+
+// touch records a read of a key.
+func (u *usage) touch(key string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if k, ok := u.keys[key]; ok {
+		u.clock++
+		k.lastAccess = u.clock
+		k.hits++
+	}
+}
+
+// victims returns the keys to evict to bring the database and its
+// collections within their limits.
+func (u *usage) victims(global limits, collections map[string]limits, policy EvictionPolicy) []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	evicted := make(map[string]bool)
+	var victims []string
+
+	// evict picks keys among the given keys until the usage is within l
+	evict := func(keys map[string]*keyUsage, current collectionUsage, l limits) {
+		for l.exceeded(current) {
+			key, k := u.sample(keys, evicted, policy)
+			if k == nil {
+				return
+			}
+
+			evicted[key] = true
+			victims = append(victims, key)
+			current.keys--
+			current.bytes -= k.size
+		}
+	}
+
+	for collection, l := range collections {
+		if cu := u.collections[collection]; cu != nil {
+			evict(cu.members, *cu, l)
+		}
+	}
+
+	// account for the keys already evicted from collections
+	current := u.total
+	for _, key := range victims {
+		current.keys--
+		current.bytes -= u.keys[key].size
+	}
+	evict(u.keys, current, global)
+
+	return victims
+}
+
+// sample returns the key policy evicts first among up to evictionSamples
+// keys that are not evicted yet, or a nil usage if there are none. u.mu
+// must be held.
+func (u *usage) sample(keys map[string]*keyUsage, evicted map[string]bool, policy EvictionPolicy) (string, *keyUsage) {
+	var victim string
+	var best *keyUsage
+
+	n := 0
+	for key, k := range keys {
+		if evicted[key] {
+			continue
+		}
+		n++
+
+		if best == nil || (policy == EvictRandom && rand.Intn(n) == 0) || (policy != EvictRandom && evictsBefore(k, best, policy)) {
+			victim, best = key, k
+		}
+
+		if n == evictionSamples {
+			break
+		}
+	}
+
+	return victim, best
+}
+
+// evictsBefore reports whether policy evicts a before b.
+func evictsBefore(a, b *keyUsage, policy EvictionPolicy) bool {
+	switch policy {
+	case EvictLFU:
+		if a.hits != b.hits {
+			return a.hits < b.hits
+		}
+	case EvictTTL:
+		if a.expiresAt.IsZero() != b.expiresAt.IsZero() {
+			return !a.expiresAt.IsZero()
+		}
+		if !a.expiresAt.Equal(b.expiresAt) {
+			return a.expiresAt.Before(b.expiresAt)
+		}
+	}
+
+	// least recently used first
+	return a.lastAccess < b.lastAccess
+}
+
+// exceeded reports whether usage exceeds the limits.
+func (l limits) exceeded(u collectionUsage) bool {
+	return (l.maxKeys > 0 && u.keys > l.maxKeys) || (l.maxMemory > 0 && u.bytes > l.maxMemory)
+}
+
+// trackUsage records a change of a key to be applied to the usage once the
+// transaction commits.
+func (tx *Tx) trackUsage(c usageChange) {
+	if tx.db.opts.limited() {
+		tx.usage = append(tx.usage, c)
+	}
+}
+
+// evict evicts keys until the database is within its limits, publishing an
+// EventEvict for each of them.
+func (db *DB) evict() {
+	if !db.opts.limited() || db.opts.replicaOf != "" {
+		return
+	}
+
+	victims := db.usage.victims(db.opts.limits, db.opts.collectionLimits, db.opts.evictionPolicy)
+	if len(victims) == 0 {
+		return
+	}
+
+	var evicted []string
+	err := db.update(context.Background(), db.db, func(tx *Tx) error {
+		for _, key := range victims {
+			collection, k := splitKey(key)
+			if err := tx.deleteKey(key, collection, k, EventEvict); err != nil && err != ErrNotFound {
+				return err
+			}
+			evicted = append(evicted, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if db.opts.onRemoved != nil {
+		db.opts.onRemoved(evicted, RemovedEvicted)
+	}
+}
@@ -0,0 +1,218 @@
+package swmemdb
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test WithMaxKeys evicts the least recently used keys
+func TestEvictLRU(t *testing.T) {
+	var mu sync.Mutex
+	var removed []string
+	var reasons []RemovalReason
+
+	db := NewBuntDb(WithMode("memory"), WithMaxKeys(3), WithOnRemoved(func(keys []string, reason RemovalReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		removed = append(removed, keys...)
+		reasons = append(reasons, reason)
+	}))
+	defer db.Close()
+
+	db.SetToCollection("users", "a", "1")
+	db.SetToCollection("users", "b", "2")
+	db.SetToCollection("users", "c", "3")
+
+	// a is used more recently than b
+	db.GetFromCollection("users", "a")
+	db.SetToCollection("users", "d", "4")
+
+	keys, _ := db.GetKeysFromCollection("users")
+	if want := []string{"a", "c", "d"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+
+	mu.Lock()
+	if want := []string{"users:b"}; !reflect.DeepEqual(removed, want) || reasons[0] != RemovedEvicted {
+		t.Errorf("OnRemoved() = %v, %v, want %v, %v", removed, reasons, want, RemovedEvicted)
+	}
+	mu.Unlock()
+}
+
+// Test the LFU, TTL and random eviction policies
+func TestEvictionPolicies(t *testing.T) {
+	// LFU keeps the most used keys
+	db := NewBuntDb(WithMode("memory"), WithMaxKeys(2), WithEvictionPolicy(EvictLFU))
+	db.SetToCollection("users", "a", "1")
+	db.SetToCollection("users", "b", "2")
+	for i := 0; i < 5; i++ {
+		db.GetFromCollection("users", "a")
+	}
+	db.SetToCollection("users", "c", "3")
+
+	keys, _ := db.GetKeysFromCollection("users")
+	if want := []string{"a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("LFU GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+	db.Close()
+
+	// TTL evicts the key expiring soonest
+	db = NewBuntDb(WithMode("memory"), WithMaxKeys(2), WithEvictionPolicy(EvictTTL))
+	db.SetToCollection("users", "a", "1", time.Hour)
+	db.SetToCollection("users", "b", "2", time.Minute)
+	db.SetToCollection("users", "c", "3")
+
+	keys, _ = db.GetKeysFromCollection("users")
+	if want := []string{"a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("TTL GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+	db.Close()
+
+	// random evicts any key
+	db = NewBuntDb(WithMode("memory"), WithMaxKeys(5), WithEvictionPolicy(EvictRandom))
+	for i := 0; i < 20; i++ {
+		db.SetToCollection("users", strconv.Itoa(i), "x")
+	}
+
+	keys, _ = db.GetKeysFromCollection("users")
+	if len(keys) != 5 {
+		t.Errorf("random GetKeysFromCollection() = %v, want %d keys", keys, 5)
+	}
+	db.Close()
+}
+
+// Test WithMaxMemory and WithCollectionLimits
+func TestEvictMemory(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithMaxMemory(1000), WithCollectionLimits("cache", 2, 0))
+	defer db.Close()
+
+	large := strings.Repeat("x", 300)
+	for i := 0; i < 5; i++ {
+		db.SetToCollection("blobs", strconv.Itoa(i), large)
+	}
+
+	keys, _ := db.GetKeysFromCollection("blobs")
+	if want := []string{"2", "3", "4"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+
+	// the collection limit leaves other collections alone
+	db.SetToCollection("cache", "a", "1")
+	db.SetToCollection("cache", "b", "2")
+	db.SetToCollection("cache", "c", "3")
+
+	keys, _ = db.GetKeysFromCollection("cache")
+	if want := []string{"b", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+
+	keys, _ = db.GetKeysFromCollection("blobs")
+	if len(keys) != 3 {
+		t.Errorf("GetKeysFromCollection() = %v, want %d keys", keys, 3)
+	}
+}
+
+// Test evictions are published to watchers and expirations are reported
+// with their reason
+func TestEvictionEvents(t *testing.T) {
+	var mu sync.Mutex
+	reasons := make(map[RemovalReason][]string)
+
+	db := NewBuntDb(WithMode("memory"), WithMaxKeys(1), WithOnRemoved(func(keys []string, reason RemovalReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		reasons[reason] = append(reasons[reason], keys...)
+	}))
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, _ := db.Watch(ctx, "users", WatchOptions{Buffer: 10, Types: []EventType{EventEvict}})
+
+	db.SetToCollection("users", "a", "1", 50*time.Millisecond)
+	db.SetToCollection("users", "b", "2", 50*time.Millisecond)
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventEvict || ev.Key != "a" || ev.OldValue != "1" {
+			t.Errorf("Watch() = %+v, want an eviction of a", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event")
+	}
+
+	waitFor(t, "expiration", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reasons[RemovedExpired]) > 0
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, keys := range reasons {
+		sort.Strings(keys)
+	}
+	want := map[RemovalReason][]string{RemovedEvicted: {"users:a"}, RemovedExpired: {"users:b"}}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("OnRemoved() = %v, want %v", reasons, want)
+	}
+}
+
+// Test keys loaded beyond the limits are evicted on open
+func TestEvictOnOpen(t *testing.T) {
+	path := t.TempDir() + "/evict.db"
+
+	db := NewBuntDb(WithMode("file"), WithFile(path))
+	for i := 0; i < 10; i++ {
+		db.SetToCollection("users", strconv.Itoa(i), "x")
+	}
+	db.Close()
+
+	db = NewBuntDb(WithMode("file"), WithFile(path), WithMaxKeys(4))
+	defer db.Close()
+
+	if keys, _ := db.GetKeysFromCollection("users"); len(keys) != 4 {
+		t.Errorf("GetKeysFromCollection() = %v, want %d keys", keys, 4)
+	}
+}
+
+// Test eviction samples keys, keeping recently used keys of a large database
+func TestEvictSampled(t *testing.T) {
+	const n = 50000
+
+	db := NewBuntDb(WithMode("memory"), WithMaxKeys(n))
+	defer db.Close()
+
+	err := db.Tx(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			if err := tx.Set("users", strconv.Itoa(i), "x"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+
+	// the most recently written keys are never the least recently used of
+	// a sample
+	for i := 0; i < 200; i++ {
+		db.SetToCollection("new", strconv.Itoa(i), "x")
+	}
+
+	if keys, _ := db.GetKeysFromCollection("users"); len(keys) != n-200 {
+		t.Errorf("GetKeysFromCollection() = %d keys, want %d", len(keys), n-200)
+	}
+
+	if keys, _ := db.GetKeysFromCollection("new"); len(keys) != 200 {
+		t.Errorf("GetKeysFromCollection() = %d keys, want %d", len(keys), 200)
+	}
+}
@@ -0,0 +1,469 @@
+package swmemdb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is the file format used by Export and Import.
+type Format int
+
+const (
+	// FormatNDJSON writes one JSON record per line:
+	// {"collection":"users","key":"alice","value":"...","expires_at":"..."}
+	FormatNDJSON Format = iota
+	// FormatJSON writes a single JSON object keyed by collection and key:
+	// {"users":{"alice":{"value":"...","expires_at":"..."}}}
+	FormatJSON
+	// FormatCSV writes the columns collection, key, value and expires_at
+	// after a header row.
+	FormatCSV
+)
+
+// ConflictPolicy decides what Import does with keys that already exist.
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite replaces existing values.
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictSkip keeps existing values.
+	ConflictSkip
+	// ConflictFail stops the import with an error wrapping ErrConflict.
+	ConflictFail
+)
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// Collections to export. All collections are exported when empty.
+	Collections []string
+	// Format of the output.
+	Format Format
+	// IncludeTTL writes the absolute expiry time of expiring keys.
+	IncludeTTL bool
+}
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// Format of the input.
+	Format Format
+	// OnConflict decides what happens to keys that already exist.
+	OnConflict ConflictPolicy
+	// BatchSize is the number of records written per transaction. Defaults
+	// to 1000.
+	BatchSize int
+}
+
+// ImportStats describes the outcome of an import.
+type ImportStats struct {
+	// Imported is the number of keys written.
+	Imported int
+	// Skipped is the number of keys kept because they already existed.
+	Skipped int
+	// Expired is the number of records skipped because their expiry time
+	// has passed.
+	Expired int
+}
+
+// record is a single key/value pair as exported.
+type record struct {
+	Collection string     `json:"collection"`
+	Key        string     `json:"key"`
+	Value      string     `json:"value"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// jsonEntry is a value in the FormatJSON format.
+type jsonEntry struct {
+	Value     string     `json:"value"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// csvHeader is the header row of the FormatCSV format.
+var csvHeader = []string{"collection", "key", "value", "expires_at"}
+
+// Export writes the keys of the selected collections to w. All keys are read
+// in a single transaction, so the export is consistent.
+func (db *DB) Export(w io.Writer, opts ExportOptions) error {
+	collections := opts.Collections
+	if len(collections) == 0 {
+		var err error
+		if collections, err = db.ListCollections(); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+
+	var enc recordEncoder
+	switch opts.Format {
+	case FormatNDJSON:
+		enc = &ndjsonEncoder{enc: json.NewEncoder(bw)}
+	case FormatJSON:
+		enc = &jsonEncoder{w: bw}
+	case FormatCSV:
+		enc = &csvEncoder{w: csv.NewWriter(bw)}
+	default:
+		return fmt.Errorf("swmemdb: unknown format %d", opts.Format)
+	}
+
+	err := db.View(func(tx *Tx) error {
+		now := time.Now()
+
+		for _, collection := range collections {
+			var records []record
+			var decodeErr error
+			err := tx.tx.AscendKeys(collectionPattern(collection), db.decodeIterator(len(collection)+1, &decodeErr, func(key, value string) bool {
+				records = append(records, record{Collection: collection, Key: key, Value: value})
+				return true
+			}))
+			if err != nil {
+				return err
+			}
+			if decodeErr != nil {
+				return decodeErr
+			}
+
+			for _, rec := range records {
+				ttl, err := tx.TTL(collection, rec.Key)
+				if err == ErrNotFound {
+					// expired
+					continue
+				} else if err != nil {
+					return err
+				}
+
+				if opts.IncludeTTL && ttl != NoExpiration {
+					expiresAt := now.Add(ttl).UTC()
+					rec.ExpiresAt = &expiresAt
+				}
+
+				if err := enc.encode(rec); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := enc.close(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Import reads records written by Export from r and stores them. Records
+// are written in batches of opts.BatchSize keys per transaction; when an
+// error occurs the batches written before it stay committed.
+func (db *DB) Import(r io.Reader, opts ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	var dec recordDecoder
+	switch opts.Format {
+	case FormatNDJSON:
+		dec = &ndjsonDecoder{dec: json.NewDecoder(r)}
+	case FormatJSON:
+		dec = &jsonDecoder{r: r}
+	case FormatCSV:
+		dec = &csvDecoder{r: csv.NewReader(r)}
+	default:
+		return stats, fmt.Errorf("swmemdb: unknown format %d", opts.Format)
+	}
+
+	batch := make([]record, 0, opts.BatchSize)
+	for {
+		rec, err := dec.decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, err
+		}
+
+		batch = append(batch, rec)
+		if len(batch) == opts.BatchSize {
+			if err := db.importBatch(batch, opts.OnConflict, &stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := db.importBatch(batch, opts.OnConflict, &stats); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// importBatch writes records in a single transaction.
+func (db *DB) importBatch(batch []record, onConflict ConflictPolicy, stats *ImportStats) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var imported, skipped, expired int
+	err := db.Tx(func(tx *Tx) error {
+		now := time.Now()
+
+		for _, rec := range batch {
+			var exp time.Duration
+			if rec.ExpiresAt != nil {
+				exp = rec.ExpiresAt.Sub(now)
+				if exp <= 0 {
+					expired++
+					continue
+				}
+			}
+
+			if onConflict != ConflictOverwrite {
+				_, err := tx.get(rec.Collection, rec.Key)
+				if err == nil {
+					if onConflict == ConflictFail {
+						return fmt.Errorf("%w: %s", ErrConflict, collectionKey(rec.Collection, rec.Key))
+					}
+					skipped++
+					continue
+				} else if err != ErrNotFound {
+					return err
+				}
+			}
+
+			if err := tx.Set(rec.Collection, rec.Key, rec.Value, exp); err != nil {
+				return err
+			}
+			imported++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	stats.Imported += imported
+	stats.Skipped += skipped
+	stats.Expired += expired
+
+	return nil
+}
+
+// recordEncoder writes records in a format.
+type recordEncoder interface {
+	encode(rec record) error
+	close() error
+}
+
+// recordDecoder reads records in a format. It returns io.EOF after the last
+// record.
+type recordDecoder interface {
+	decode() (record, error)
+}
+
+// ndjsonEncoder writes FormatNDJSON.
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) encode(rec record) error {
+	return e.enc.Encode(rec)
+}
+
+func (e *ndjsonEncoder) close() error {
+	return nil
+}
+
+// ndjsonDecoder reads FormatNDJSON.
+type ndjsonDecoder struct {
+	dec *json.Decoder
+}
+
+func (d *ndjsonDecoder) decode() (record, error) {
+	var rec record
+	if err := d.dec.Decode(&rec); err != nil {
+		return rec, err
+	}
+
+	return rec, validateRecord(rec)
+}
+
+// jsonEncoder writes FormatJSON.
+type jsonEncoder struct {
+	w          *bufio.Writer
+	collection string
+	started    bool
+}
+
+func (e *jsonEncoder) encode(rec record) error {
+	if !e.started || rec.Collection != e.collection {
+		if !e.started {
+			e.w.WriteString("{")
+		} else {
+			e.w.WriteString("},")
+		}
+
+		name, err := json.Marshal(rec.Collection)
+		if err != nil {
+			return err
+		}
+		e.w.Write(name)
+		e.w.WriteString(":{")
+
+		e.collection = rec.Collection
+		e.started = true
+	} else {
+		e.w.WriteString(",")
+	}
+
+	key, err := json.Marshal(rec.Key)
+	if err != nil {
+		return err
+	}
+
+	entry, err := json.Marshal(jsonEntry{Value: rec.Value, ExpiresAt: rec.ExpiresAt})
+	if err != nil {
+		return err
+	}
+
+	e.w.Write(key)
+	e.w.WriteString(":")
+	_, err = e.w.Write(entry)
+	return err
+}
+
+func (e *jsonEncoder) close() error {
+	if !e.started {
+		_, err := e.w.WriteString("{}\n")
+		return err
+	}
+
+	_, err := e.w.WriteString("}}\n")
+	return err
+}
+
+// jsonDecoder reads FormatJSON. The whole object is read on the first call.
+type jsonDecoder struct {
+	r       io.Reader
+	records []record
+	read    bool
+}
+
+func (d *jsonDecoder) decode() (record, error) {
+	if !d.read {
+		d.read = true
+
+		var doc map[string]map[string]jsonEntry
+		if err := json.NewDecoder(d.r).Decode(&doc); err != nil {
+			return record{}, err
+		}
+
+		for collection, entries := range doc {
+			for key, entry := range entries {
+				d.records = append(d.records, record{Collection: collection, Key: key, Value: entry.Value, ExpiresAt: entry.ExpiresAt})
+			}
+		}
+
+		// import in key order
+		sort.Slice(d.records, func(i, j int) bool {
+			return collectionKey(d.records[i].Collection, d.records[i].Key) < collectionKey(d.records[j].Collection, d.records[j].Key)
+		})
+	}
+
+	if len(d.records) == 0 {
+		return record{}, io.EOF
+	}
+
+	rec := d.records[0]
+	d.records = d.records[1:]
+
+	return rec, validateRecord(rec)
+}
+
+// csvEncoder writes FormatCSV.
+type csvEncoder struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvEncoder) encode(rec record) error {
+	if !e.started {
+		e.started = true
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	var expiresAt string
+	if rec.ExpiresAt != nil {
+		expiresAt = rec.ExpiresAt.Format(time.RFC3339Nano)
+	}
+
+	return e.w.Write([]string{rec.Collection, rec.Key, rec.Value, expiresAt})
+}
+
+func (e *csvEncoder) close() error {
+	if !e.started {
+		e.w.Write(csvHeader)
+	}
+
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvDecoder reads FormatCSV.
+type csvDecoder struct {
+	r       *csv.Reader
+	started bool
+}
+
+func (d *csvDecoder) decode() (record, error) {
+	if !d.started {
+		d.started = true
+
+		header, err := d.r.Read()
+		if err != nil {
+			return record{}, err
+		}
+		if strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+			return record{}, fmt.Errorf("swmemdb: invalid csv header %q", header)
+		}
+	}
+
+	row, err := d.r.Read()
+	if err != nil {
+		return record{}, err
+	}
+
+	rec := record{Collection: row[0], Key: row[1], Value: row[2]}
+	if row[3] != "" {
+		expiresAt, err := time.Parse(time.RFC3339Nano, row[3])
+		if err != nil {
+			return record{}, fmt.Errorf("swmemdb: invalid expires_at %q: %w", row[3], err)
+		}
+		rec.ExpiresAt = &expiresAt
+	}
+
+	return rec, validateRecord(rec)
+}
+
+// validateRecord checks that a decoded record names a collection.
+func validateRecord(rec record) error {
+	if rec.Collection == "" {
+		return fmt.Errorf("swmemdb: record %q has no collection", rec.Key)
+	}
+
+	return nil
+}
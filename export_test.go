@@ -0,0 +1,187 @@
+package swmemdb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exportTestDb returns a database with two collections and an expiring key.
+func exportTestDb(t *testing.T) *DB {
+	db := NewBuntDb(WithMode("memory"))
+
+	err := db.Tx(func(tx *Tx) error {
+		if err := tx.Set("users", "alice", `{"name":"alice"}`); err != nil {
+			return err
+		}
+		if err := tx.Set("users", "bob", "line1\nline2, with comma", time.Hour); err != nil {
+			return err
+		}
+		return tx.Set("orders", "1", "x")
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+
+	return db
+}
+
+// Test that every format round-trips values and expiry times
+func TestExportImportRoundTrip(t *testing.T) {
+	db := exportTestDb(t)
+	defer db.Close()
+
+	bobTTL, _ := db.TTLInCollection("users", "bob")
+	bobExpiresAt := time.Now().Add(bobTTL)
+
+	for name, format := range map[string]Format{"ndjson": FormatNDJSON, "json": FormatJSON, "csv": FormatCSV} {
+		var buf bytes.Buffer
+		err := db.Export(&buf, ExportOptions{Format: format, IncludeTTL: true})
+		if err != nil {
+			t.Fatalf("%s Export() = %v, want %v", name, err, "nil")
+		}
+
+		target := NewBuntDb(WithMode("memory"))
+
+		stats, err := target.Import(&buf, ImportOptions{Format: format, BatchSize: 2})
+		if err != nil {
+			t.Fatalf("%s Import() = %v, want %v", name, err, "nil")
+		}
+
+		if want := (ImportStats{Imported: 3}); stats != want {
+			t.Errorf("%s Import() = %+v, want %+v", name, stats, want)
+		}
+
+		for _, kv := range [][3]string{
+			{"users", "alice", `{"name":"alice"}`},
+			{"users", "bob", "line1\nline2, with comma"},
+			{"orders", "1", "x"},
+		} {
+			val, err := target.GetFromCollection(kv[0], kv[1])
+			if err != nil || val != kv[2] {
+				t.Errorf("%s GetFromCollection(%s, %s) = %q, %v, want %q", name, kv[0], kv[1], val, err, kv[2])
+			}
+		}
+
+		ttl, err := target.TTLInCollection("users", "bob")
+		if err != nil {
+			t.Errorf("%s TTLInCollection() = %v, want %v", name, err, "nil")
+		}
+
+		// the imported key expires at the original time
+		if diff := time.Now().Add(ttl).Sub(bobExpiresAt); diff < -time.Second || diff > time.Second {
+			t.Errorf("%s TTLInCollection() = %v, want %v", name, ttl, bobTTL)
+		}
+
+		ttl, _ = target.TTLInCollection("users", "alice")
+		if ttl != NoExpiration {
+			t.Errorf("%s TTLInCollection() = %v, want %v", name, ttl, NoExpiration)
+		}
+
+		target.Close()
+	}
+}
+
+// Test exporting selected collections without TTLs
+func TestExportCollections(t *testing.T) {
+	db := exportTestDb(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	err := db.Export(&buf, ExportOptions{Collections: []string{"orders"}, Format: FormatNDJSON})
+	if err != nil {
+		t.Fatalf("Export() = %v, want %v", err, "nil")
+	}
+
+	want := `{"collection":"orders","key":"1","value":"x"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("Export() = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	err = db.Export(&buf, ExportOptions{Collections: []string{"empty"}, Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("Export() = %v, want %v", err, "nil")
+	}
+
+	if buf.String() != "{}\n" {
+		t.Errorf("Export() = %q, want %q", buf.String(), "{}\n")
+	}
+}
+
+// Test the conflict policies of Import
+func TestImportConflicts(t *testing.T) {
+	input := `{"collection":"users","key":"alice","value":"new"}
+{"collection":"users","key":"carol","value":"3"}
+`
+
+	for _, tc := range []struct {
+		policy ConflictPolicy
+		stats  ImportStats
+		alice  string
+		err    error
+	}{
+		{ConflictOverwrite, ImportStats{Imported: 2}, "new", nil},
+		{ConflictSkip, ImportStats{Imported: 1, Skipped: 1}, `{"name":"alice"}`, nil},
+		{ConflictFail, ImportStats{}, `{"name":"alice"}`, ErrConflict},
+	} {
+		db := exportTestDb(t)
+
+		stats, err := db.Import(strings.NewReader(input), ImportOptions{OnConflict: tc.policy})
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Import(%v) = %v, want %v", tc.policy, err, tc.err)
+		}
+
+		if stats != tc.stats {
+			t.Errorf("Import(%v) = %+v, want %+v", tc.policy, stats, tc.stats)
+		}
+
+		val, _ := db.GetFromCollection("users", "alice")
+		if val != tc.alice {
+			t.Errorf("GetFromCollection() = %v, want %v", val, tc.alice)
+		}
+
+		db.Close()
+	}
+}
+
+// Test that expired records are skipped and invalid input is rejected
+func TestImportExpiredAndInvalid(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	input := "collection,key,value,expires_at\n" +
+		"users,old,1,2001-01-01T00:00:00Z\n" +
+		"users,new,2,\n"
+
+	stats, err := db.Import(strings.NewReader(input), ImportOptions{Format: FormatCSV})
+	if err != nil {
+		t.Fatalf("Import() = %v, want %v", err, "nil")
+	}
+
+	if want := (ImportStats{Imported: 1, Expired: 1}); stats != want {
+		t.Errorf("Import() = %+v, want %+v", stats, want)
+	}
+
+	keys, _ := db.GetKeysFromCollection("users")
+	if want := []string{"new"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+
+	for _, tc := range []struct {
+		format Format
+		input  string
+	}{
+		{FormatCSV, "a,b\n"},
+		{FormatNDJSON, `{"key":"nocollection","value":"x"}`},
+		{FormatJSON, `[1, 2]`},
+	} {
+		_, err := db.Import(strings.NewReader(tc.input), ImportOptions{Format: tc.format})
+		if err == nil {
+			t.Errorf("Import(%q) = %v, want %v", tc.input, err, "error")
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package swmemdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultKeysLimit is the page size of key listings without a limit.
+	defaultKeysLimit = 100
+	// maxKeysLimit is the largest page size of key listings.
+	maxKeysLimit = 1000
+	// defaultMaxBodySize is the largest value accepted on PUT by default.
+	defaultMaxBodySize = 1 << 20
+)
+
+// httpHandler serves the REST API of a database.
+type httpHandler struct {
+	db          *DB
+	maxBodySize int64
+}
+
+// HTTPOption configures NewHTTPHandler.
+type HTTPOption func(h *httpHandler)
+
+// MaxBodySize sets the largest value accepted on PUT, in bytes. Larger
+// bodies are refused with 413 Request Entity Too Large. Defaults to 1 MiB.
+func MaxBodySize(n int64) HTTPOption {
+	return func(h *httpHandler) {
+		h.maxBodySize = n
+	}
+}
+
+// NewHTTPHandler returns an http.Handler serving db as a REST API:
+//
+//	GET    /collections/{c}/keys/{k}   get a value
+//	PUT    /collections/{c}/keys/{k}   set a value to the request body
+//	DELETE /collections/{c}/keys/{k}   delete a value
+//	GET    /collections/{c}/keys       list keys (prefix, limit, cursor)
+//
+// The time to live of a value is passed on PUT in the X-TTL header or the
+// ttl query parameter, either as a duration ("1m30s") or in seconds. GET
+// returns the remaining time to live in seconds in the X-TTL header.
+func NewHTTPHandler(db *DB, opts ...HTTPOption) http.Handler {
+	h := &httpHandler{db: db, maxBodySize: defaultMaxBodySize}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// keysResponse is the body of a key listing.
+type keysResponse struct {
+	Keys       []string `json:"keys"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// errorResponse is the body of a failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	collection, key, hasKey, ok := parseHTTPPath(r.URL.EscapedPath())
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case !hasKey && r.Method == http.MethodGet:
+		h.listKeys(w, r, collection)
+	case hasKey && r.Method == http.MethodGet:
+		h.get(w, r, collection, key)
+	case hasKey && r.Method == http.MethodPut:
+		h.put(w, r, collection, key)
+	case hasKey && r.Method == http.MethodDelete:
+		h.delete(w, r, collection, key)
+	default:
+		if hasKey {
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+		} else {
+			w.Header().Set("Allow", "GET")
+		}
+		writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// get writes the value of a key.
+func (h *httpHandler) get(w http.ResponseWriter, r *http.Request, collection, key string) {
+	var value string
+	var ttl time.Duration
+
+	err := h.db.ViewCtx(r.Context(), func(tx *Tx) error {
+		var err error
+		if value, err = tx.Get(collection, key); err != nil {
+			return err
+		}
+		ttl, err = tx.TTL(collection, key)
+		return err
+	})
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	if ttl != NoExpiration {
+		w.Header().Set("X-TTL", strconv.FormatInt(int64(math.Ceil(ttl.Seconds())), 10))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.WriteString(w, value)
+}
+
+// put sets the value of a key to the request body.
+func (h *httpHandler) put(w http.ResponseWriter, r *http.Request, collection, key string) {
+	raw := r.Header.Get("X-TTL")
+	if raw == "" {
+		raw = r.URL.Query().Get("ttl")
+	}
+
+	ttl, err := parseTTL(raw)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.db.SetToCollectionCtx(r.Context(), collection, key, string(value), ttl)
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delete deletes a key.
+func (h *httpHandler) delete(w http.ResponseWriter, r *http.Request, collection, key string) {
+	err := h.db.TxCtx(r.Context(), func(tx *Tx) error {
+		return tx.Delete(collection, key)
+	})
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listKeys writes a page of the keys of a collection.
+func (h *httpHandler) listKeys(w http.ResponseWriter, r *http.Request, collection string) {
+	query := r.URL.Query()
+
+	limit := defaultKeysLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", raw))
+			return
+		}
+		limit = n
+	}
+	if limit > maxKeysLimit {
+		limit = maxKeysLimit
+	}
+
+	keys, more, err := h.db.keysPage(r.Context(), collection, query.Get("prefix"), query.Get("cursor"), limit)
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	resp := keysResponse{Keys: keys}
+	if resp.Keys == nil {
+		resp.Keys = []string{}
+	}
+	if more {
+		resp.NextCursor = keys[len(keys)-1]
+	}
+
+	writeHTTPJSON(w, http.StatusOK, resp)
+}
+
+// keysPage returns up to limit keys of a collection starting with prefix
+// that sort after cursor, and whether more keys follow.
+func (db *DB) keysPage(ctx context.Context, collection, prefix, cursor string, limit int) (keys []string, more bool, err error) {
+	start := collectionKey(collection, prefix)
+	if cursor != "" && collectionKey(collection, cursor) >= start {
+		// continue right after the cursor
+		start = collectionKey(collection, cursor) + "\x00"
+	}
+
+	err = db.ViewCtx(ctx, func(tx *Tx) error {
+		return tx.tx.AscendGreaterOrEqual("", start, func(key, value string) bool {
+			if !strings.HasPrefix(key, collectionKey(collection, prefix)) {
+				return false
+			}
+
+			key = key[len(collection)+1:]
+			if isElementKey(key) {
+				return true
+			}
+
+			if len(keys) == limit {
+				more = true
+				return false
+			}
+
+			keys = append(keys, key)
+			return true
+		})
+	})
+
+	return keys, more, err
+}
+
+// parseHTTPPath splits /collections/{c}/keys[/{k}] into its unescaped parts.
+func parseHTTPPath(path string) (collection, key string, hasKey, ok bool) {
+	rest, found := strings.CutPrefix(path, "/collections/")
+	if !found {
+		return "", "", false, false
+	}
+
+	rawCollection, rest, found := strings.Cut(rest, "/")
+	if !found || rawCollection == "" {
+		return "", "", false, false
+	}
+
+	rest, found = strings.CutPrefix(rest, "keys")
+	if !found || (rest != "" && rest[0] != '/') {
+		return "", "", false, false
+	}
+
+	collection, err := url.PathUnescape(rawCollection)
+	if err != nil {
+		return "", "", false, false
+	}
+
+	if rest == "" || rest == "/" {
+		return collection, "", false, true
+	}
+
+	key, err = url.PathUnescape(rest[1:])
+	if err != nil {
+		return "", "", false, false
+	}
+
+	return collection, key, true, true
+}
+
+// parseTTL parses a time to live given as a duration or in seconds. An empty
+// string means no expiration.
+func parseTTL(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if seconds, serr := strconv.ParseInt(raw, 10, 64); serr == nil {
+		ttl, err = time.Duration(seconds)*time.Second, nil
+	}
+
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid ttl %q", raw)
+	}
+
+	return ttl, nil
+}
+
+// httpStatus maps an error to a status code.
+func httpStatus(err error) int {
+	if errors.Is(err, ErrNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, ErrReadOnly) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
+// writeHTTPError writes err as a JSON error response.
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	writeHTTPJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeHTTPJSON writes v as a JSON response.
+func writeHTTPJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,196 @@
+package swmemdb
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// httpTestRequest performs a request against handler.
+func httpTestRequest(t *testing.T, handler http.Handler, method, target, body string, header map[string]string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec.Result()
+}
+
+// Test PUT, GET and DELETE of a single key
+func TestHTTPHandlerKey(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	handler := NewHTTPHandler(db)
+
+	resp := httpTestRequest(t, handler, http.MethodPut, "/collections/users/keys/alice", "hello", map[string]string{"X-TTL": "1m"})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodGet, "/collections/users/keys/alice", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello" {
+		t.Errorf("GET body = %v, want %v", string(body), "hello")
+	}
+
+	if ttl := resp.Header.Get("X-TTL"); ttl != "60" {
+		t.Errorf("GET X-TTL = %v, want %v", ttl, "60")
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodDelete, "/collections/users/keys/alice", "", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodGet, "/collections/users/keys/alice", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET status = %v, want %v", resp.StatusCode, http.StatusNotFound)
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodDelete, "/collections/users/keys/alice", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE status = %v, want %v", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+// Test PUT refuses bodies larger than MaxBodySize
+func TestHTTPHandlerMaxBodySize(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	handler := NewHTTPHandler(db, MaxBodySize(4))
+
+	resp := httpTestRequest(t, handler, http.MethodPut, "/collections/users/keys/alice", "hello", nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	if _, err := db.GetFromCollection("users", "alice"); err != ErrNotFound {
+		t.Errorf("GetFromCollection() = %v, want %v", err, ErrNotFound)
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodPut, "/collections/users/keys/alice", "hell", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+// Test the TTL query parameter, escaped keys and values without expiration
+func TestHTTPHandlerTTLAndEscaping(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	handler := NewHTTPHandler(db)
+
+	resp := httpTestRequest(t, handler, http.MethodPut, "/collections/files/keys/a%2Fb.txt?ttl=30", "x", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+
+	ttl, err := db.TTLInCollection("files", "a/b.txt")
+	if err != nil {
+		t.Errorf("TTLInCollection() = %v, want %v", err, "nil")
+	}
+
+	if ttl <= 29*time.Second || ttl > 30*time.Second {
+		t.Errorf("TTLInCollection() = %v, want %v", ttl, 30*time.Second)
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodPut, "/collections/files/keys/c", "y", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodGet, "/collections/files/keys/c", "", nil)
+	if ttl := resp.Header.Get("X-TTL"); ttl != "" {
+		t.Errorf("GET X-TTL = %v, want %v", ttl, "")
+	}
+
+	resp = httpTestRequest(t, handler, http.MethodPut, "/collections/files/keys/d", "z", map[string]string{"X-TTL": "soon"})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// Test listing keys with prefix, limit and cursor
+func TestHTTPHandlerListKeys(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	handler := NewHTTPHandler(db)
+
+	for _, key := range []string{"user1", "user2", "user3", "admin1"} {
+		err := db.SetToCollection("accounts", key, "x")
+		if err != nil {
+			t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+		}
+	}
+
+	list := func(target string) keysResponse {
+		resp := httpTestRequest(t, handler, http.MethodGet, target, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET status = %v, want %v", resp.StatusCode, http.StatusOK)
+		}
+
+		var body keysResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Errorf("Decode() = %v, want %v", err, "nil")
+		}
+		return body
+	}
+
+	page := list("/collections/accounts/keys?prefix=user&limit=2")
+	if want := (keysResponse{Keys: []string{"user1", "user2"}, NextCursor: "user2"}); !reflect.DeepEqual(page, want) {
+		t.Errorf("GET keys = %v, want %v", page, want)
+	}
+
+	page = list("/collections/accounts/keys?prefix=user&limit=2&cursor=" + page.NextCursor)
+	if want := (keysResponse{Keys: []string{"user3"}}); !reflect.DeepEqual(page, want) {
+		t.Errorf("GET keys = %v, want %v", page, want)
+	}
+
+	page = list("/collections/accounts/keys")
+	if want := (keysResponse{Keys: []string{"admin1", "user1", "user2", "user3"}}); !reflect.DeepEqual(page, want) {
+		t.Errorf("GET keys = %v, want %v", page, want)
+	}
+
+	page = list("/collections/empty/keys")
+	if want := (keysResponse{Keys: []string{}}); !reflect.DeepEqual(page, want) {
+		t.Errorf("GET keys = %v, want %v", page, want)
+	}
+
+	resp := httpTestRequest(t, handler, http.MethodGet, "/collections/accounts/keys?limit=-1", "", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET status = %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// Test unknown routes and methods
+func TestHTTPHandlerRouting(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	handler := NewHTTPHandler(db)
+
+	for _, target := range []string{"/", "/collections", "/collections//keys", "/collections/users/values"} {
+		resp := httpTestRequest(t, handler, http.MethodGet, target, "", nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s status = %v, want %v", target, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+
+	resp := httpTestRequest(t, handler, http.MethodPost, "/collections/users/keys", "", nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
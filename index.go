@@ -0,0 +1,289 @@
+package swmemdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// IndexItem is a key/value pair returned by an index query. The key is
+// relative to the indexed collection.
+type IndexItem struct {
+	Key   string
+	Value string
+}
+
+// indexSpec describes a secondary index over the values of a collection.
+type indexSpec struct {
+	collection string
+	name       string
+	fields     []string
+}
+
+// lessers returns the less functions of the index. Without fields the whole
+// value is compared as a case-insensitive string.
+func (s indexSpec) lessers() []func(a, b string) bool {
+	if len(s.fields) == 0 {
+		return []func(a, b string) bool{bunt.IndexString}
+	}
+
+	lessers := make([]func(a, b string) bool, len(s.fields))
+	for i, field := range s.fields {
+		lessers[i] = bunt.IndexJSON(field)
+	}
+
+	return lessers
+}
+
+// pivot returns a value that compares equal to values whose first fields
+// hold the given values.
+func (s indexSpec) pivot(values ...interface{}) (string, error) {
+	if len(s.fields) == 0 {
+		if len(values) != 1 {
+			return "", fmt.Errorf("swmemdb: index %s takes 1 value, got %d", s.name, len(values))
+		}
+		return fmt.Sprint(values[0]), nil
+	}
+
+	if len(values) > len(s.fields) {
+		return "", fmt.Errorf("swmemdb: index %s takes at most %d values, got %d", s.name, len(s.fields), len(values))
+	}
+
+	doc := map[string]interface{}{}
+	for i, value := range values {
+		// build the nested objects of dotted paths
+		parts := strings.Split(s.fields[i], ".")
+		obj := doc
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := obj[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				obj[part] = next
+			}
+			obj = next
+		}
+		obj[parts[len(parts)-1]] = value
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// create creates the index in the given transaction.
+func (s indexSpec) create(tx *bunt.Tx) error {
+	return tx.CreateIndex(s.name, collectionPattern(s.collection), s.lessers()...)
+}
+
+// iterator wraps fn so that it receives collection-relative keys and
+// decoded values. See DB.decodeIterator.
+func (s indexSpec) iterator(db *DB, errp *error, fn func(key, value string) bool) func(key, value string) bool {
+	return db.decodeIterator(len(s.collection)+1, errp, fn)
+}
+
+// WithIndex creates an index over the values of a collection whenever the
+// database is opened. See DB.CreateIndex; opening fails with
+// ErrInvalidConfig if the values of the collection are encrypted or
+// compressed.
+func WithIndex(collection, name string, fields ...string) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.indexes = append(o.indexes, indexSpec{collection: collection, name: name, fields: fields})
+	}
+}
+
+// CreateIndex creates an index named name over the values of a collection.
+// Each field is a JSON path into the values; values are ordered by the first
+// field, then the second and so on. Without fields the values are ordered as
+// case-insensitive strings.
+//
+// Indexes are kept in memory only and are recreated when the database is
+// reopened with Init. Indexes cannot order encrypted or compressed values,
+// so indexing an encrypted database or a collection whose values are
+// compressed fails with ErrInvalidConfig.
+func (db *DB) CreateIndex(collection, name string, fields ...string) error {
+	spec := indexSpec{collection: collection, name: name, fields: fields}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.checkIndex(spec); err != nil {
+		return fmt.Errorf("%w: index %s: %w", ErrInvalidConfig, name, err)
+	}
+
+	err := db.db.Update(func(tx *bunt.Tx) error {
+		return spec.create(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	db.opts.indexes = append(db.opts.indexes, spec)
+
+	return nil
+}
+
+// DropIndex removes an index.
+func (db *DB) DropIndex(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.db.Update(func(tx *bunt.Tx) error {
+		return tx.DropIndex(name)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, spec := range db.opts.indexes {
+		if spec.name == name {
+			db.opts.indexes = append(db.opts.indexes[:i:i], db.opts.indexes[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Indexes returns the names of all indexes.
+func (db *DB) Indexes() ([]string, error) {
+	return db.db.Indexes()
+}
+
+// AscendIndex calls fn for every item of the index in ascending order until
+// fn returns false.
+func (db *DB) AscendIndex(name string, fn func(key, value string) bool) error {
+	spec, err := db.index(name)
+	if err != nil {
+		return err
+	}
+
+	return db.db.View(func(tx *bunt.Tx) error {
+		var decodeErr error
+		if err := tx.Ascend(name, spec.iterator(db, &decodeErr, fn)); err != nil {
+			return err
+		}
+		return decodeErr
+	})
+}
+
+// DescendIndex calls fn for every item of the index in descending order until
+// fn returns false.
+func (db *DB) DescendIndex(name string, fn func(key, value string) bool) error {
+	spec, err := db.index(name)
+	if err != nil {
+		return err
+	}
+
+	return db.db.View(func(tx *bunt.Tx) error {
+		var decodeErr error
+		if err := tx.Descend(name, spec.iterator(db, &decodeErr, fn)); err != nil {
+			return err
+		}
+		return decodeErr
+	})
+}
+
+// Range returns the items of the index whose first field is within the range
+// [from, to), in ascending order.
+func (db *DB) Range(name string, from, to interface{}) ([]IndexItem, error) {
+	spec, err := db.index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	greaterOrEqual, err := spec.pivot(from)
+	if err != nil {
+		return nil, err
+	}
+
+	lessThan, err := spec.pivot(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []IndexItem
+	err = db.db.View(func(tx *bunt.Tx) error {
+		var decodeErr error
+		err := tx.AscendRange(name, greaterOrEqual, lessThan, spec.iterator(db, &decodeErr, func(key, value string) bool {
+			items = append(items, IndexItem{Key: key, Value: value})
+			return true
+		}))
+		if err != nil {
+			return err
+		}
+		return decodeErr
+	})
+
+	return items, err
+}
+
+// EqualTo returns the items of the index whose fields equal the given values,
+// in ascending order. Fewer values than fields may be given, in which case
+// only the leading fields are compared.
+func (db *DB) EqualTo(name string, values ...interface{}) ([]IndexItem, error) {
+	spec, err := db.index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pivot, err := spec.pivot(values...)
+	if err != nil {
+		return nil, err
+	}
+
+	lessers := spec.lessers()[:len(values)]
+
+	var items []IndexItem
+	err = db.db.View(func(tx *bunt.Tx) error {
+		var decodeErr error
+		err := tx.AscendGreaterOrEqual(name, pivot, spec.iterator(db, &decodeErr, func(key, value string) bool {
+			for _, less := range lessers {
+				if less(pivot, value) {
+					return false
+				}
+			}
+			items = append(items, IndexItem{Key: key, Value: value})
+			return true
+		}))
+		if err != nil {
+			return err
+		}
+		return decodeErr
+	})
+
+	return items, err
+}
+
+// index returns the spec of the named index.
+func (db *DB) index(name string) (indexSpec, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, spec := range db.opts.indexes {
+		if spec.name == name {
+			return spec, nil
+		}
+	}
+
+	return indexSpec{}, ErrNotFound
+}
+
+// checkIndex checks that the values of the collection of an index are
+// neither encrypted nor compressed, since the index would order the stored
+// bytes.
+func (db *DB) checkIndex(spec indexSpec) error {
+	if db.cipher.Load() != nil {
+		return fmt.Errorf("values are encrypted")
+	}
+
+	if db.compressionRule(spec.collection).compressor != nil {
+		return fmt.Errorf("values of collection %q are compressed", spec.collection)
+	}
+
+	return nil
+}
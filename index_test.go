@@ -0,0 +1,203 @@
+package swmemdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+// indexTestDb returns a database with a few users in the users collection
+// and an unrelated key in the other collection.
+func indexTestDb(t *testing.T, options ...BuntDbOptionsFn) *DB {
+	db, err := Open(append([]BuntDbOptionsFn{WithMode("memory")}, options...)...)
+	if err != nil {
+		t.Fatalf("Open() = %v, want %v", err, "nil")
+	}
+
+	users := map[string]string{
+		"1": `{"name":"carol","age":35,"address":{"city":"Oslo"}}`,
+		"2": `{"name":"alice","age":30,"address":{"city":"Bergen"}}`,
+		"3": `{"name":"bob","age":30,"address":{"city":"Oslo"}}`,
+		"4": `{"name":"dave","age":41,"address":{"city":"Bergen"}}`,
+	}
+	for key, value := range users {
+		err := db.db.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set("users:"+key, value, nil)
+			return err
+		})
+		if err != nil {
+			t.Errorf("Set() = %v, want %v", err, "nil")
+		}
+	}
+
+	err = db.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("other:1", `{"name":"zed","age":30}`, nil)
+		return err
+	})
+	if err != nil {
+		t.Errorf("Set() = %v, want %v", err, "nil")
+	}
+
+	return db
+}
+
+// indexItemKeys returns the keys of the items.
+func indexItemKeys(items []IndexItem) []string {
+	keys := []string{}
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+// Test CreateIndex with AscendIndex and DescendIndex
+func TestCreateIndexAscendDescend(t *testing.T) {
+	db := indexTestDb(t)
+	defer db.Close()
+
+	err := db.CreateIndex("users", "users_by_name", "name")
+	if err != nil {
+		t.Fatalf("CreateIndex() = %v, want %v", err, "nil")
+	}
+
+	var keys []string
+	err = db.AscendIndex("users_by_name", func(key, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Errorf("AscendIndex() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"2", "3", "1", "4"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("AscendIndex() = %v, want %v", keys, want)
+	}
+
+	keys = nil
+	err = db.DescendIndex("users_by_name", func(key, value string) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if err != nil {
+		t.Errorf("DescendIndex() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"4", "1"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("DescendIndex() = %v, want %v", keys, want)
+	}
+}
+
+// Test Range and EqualTo on a single field index
+func TestIndexRangeAndEqualTo(t *testing.T) {
+	db := indexTestDb(t)
+	defer db.Close()
+
+	err := db.CreateIndex("users", "users_by_age", "age")
+	if err != nil {
+		t.Fatalf("CreateIndex() = %v, want %v", err, "nil")
+	}
+
+	items, err := db.Range("users_by_age", 30, 41)
+	if err != nil {
+		t.Errorf("Range() = %v, want %v", err, "nil")
+	}
+
+	if keys, want := indexItemKeys(items), []string{"2", "3", "1"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Range() = %v, want %v", keys, want)
+	}
+
+	items, err = db.EqualTo("users_by_age", 30)
+	if err != nil {
+		t.Errorf("EqualTo() = %v, want %v", err, "nil")
+	}
+
+	if keys, want := indexItemKeys(items), []string{"2", "3"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("EqualTo() = %v, want %v", keys, want)
+	}
+
+	if items[0].Value != `{"name":"alice","age":30,"address":{"city":"Bergen"}}` {
+		t.Errorf("EqualTo() = %v, want %v", items[0].Value, "alice")
+	}
+}
+
+// Test EqualTo on a compound index with nested fields
+func TestIndexEqualToCompound(t *testing.T) {
+	db := indexTestDb(t, WithIndex("users", "users_by_city_age", "address.city", "age"))
+	defer db.Close()
+
+	items, err := db.EqualTo("users_by_city_age", "oslo")
+	if err != nil {
+		t.Errorf("EqualTo() = %v, want %v", err, "nil")
+	}
+
+	if keys, want := indexItemKeys(items), []string{"3", "1"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("EqualTo() = %v, want %v", keys, want)
+	}
+
+	items, err = db.EqualTo("users_by_city_age", "Bergen", 41)
+	if err != nil {
+		t.Errorf("EqualTo() = %v, want %v", err, "nil")
+	}
+
+	if keys, want := indexItemKeys(items), []string{"4"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("EqualTo() = %v, want %v", keys, want)
+	}
+
+	_, err = db.EqualTo("users_by_city_age", "Bergen", 41, "extra")
+	if err == nil {
+		t.Errorf("EqualTo() = %v, want %v", err, "error")
+	}
+}
+
+// Test that indexes are recreated when the database is reopened
+func TestIndexRecreatedOnInit(t *testing.T) {
+	db := indexTestDb(t, WithIndex("users", "users_by_name", "name"))
+	defer db.Close()
+
+	err := db.CreateIndex("users", "users_by_age", "age")
+	if err != nil {
+		t.Fatalf("CreateIndex() = %v, want %v", err, "nil")
+	}
+
+	err = db.Init()
+	if err != nil {
+		t.Fatalf("Init() = %v, want %v", err, "nil")
+	}
+
+	names, err := db.Indexes()
+	if err != nil {
+		t.Errorf("Indexes() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"users_by_age", "users_by_name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Indexes() = %v, want %v", names, want)
+	}
+}
+
+// Test DropIndex and querying unknown indexes
+func TestDropIndex(t *testing.T) {
+	db := indexTestDb(t)
+	defer db.Close()
+
+	err := db.CreateIndex("users", "users_by_name", "name")
+	if err != nil {
+		t.Fatalf("CreateIndex() = %v, want %v", err, "nil")
+	}
+
+	err = db.CreateIndex("users", "users_by_name", "name")
+	if !errors.Is(err, buntdb.ErrIndexExists) {
+		t.Errorf("CreateIndex() = %v, want %v", err, buntdb.ErrIndexExists)
+	}
+
+	err = db.DropIndex("users_by_name")
+	if err != nil {
+		t.Errorf("DropIndex() = %v, want %v", err, "nil")
+	}
+
+	_, err = db.EqualTo("users_by_name", "alice")
+	if !errors.Is(err, buntdb.ErrNotFound) {
+		t.Errorf("EqualTo() = %v, want %v", err, buntdb.ErrNotFound)
+	}
+}
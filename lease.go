@@ -0,0 +1,180 @@
+package swmemdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Leases are stored in the reserved _meta collection, so they survive
+// restarts in file mode and expire with their time to live.
+const (
+	// leasePrefix prefixes the keys of leases in metaCollection.
+	leasePrefix = "lease:"
+	// leaseTokenKey is the key of the last fencing token in metaCollection.
+	leaseTokenKey = "lease-token"
+)
+
+// Lease grants its owner exclusive use of a named resource until it expires
+// or is released.
+type Lease struct {
+	// Name is the name of the leased resource.
+	Name string
+	// Owner identifies the holder of the lease.
+	Owner string
+	// Token is the fencing token of the lease. Every acquired lease gets a
+	// token greater than all tokens issued before, so resources can reject
+	// requests of holders whose lease has been taken over.
+	Token uint64
+	// Expires is the time the lease expires unless it is renewed.
+	Expires time.Time
+
+	db *DB
+}
+
+// leaseRecord is the stored form of a lease.
+type leaseRecord struct {
+	Owner string `json:"owner"`
+	Token uint64 `json:"token"`
+}
+
+// AcquireLease acquires the lease on a named resource for owner for the
+// given time to live. Fails with ErrLeaseHeld if another owner holds the
+// lease. Acquiring a lease held by the same owner replaces it with a new
+// one.
+func (db *DB) AcquireLease(name, owner string, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		return Lease{}, fmt.Errorf("%w: lease ttl must be positive", ErrInvalidConfig)
+	}
+
+	lease := Lease{Name: name, Owner: owner, db: db}
+
+	err := db.Tx(func(tx *Tx) error {
+		held, err := tx.lease(name)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+
+		if err == nil && held.Owner != owner {
+			return fmt.Errorf("%w: %s", ErrLeaseHeld, name)
+		}
+
+		token, err := tx.Incr(metaCollection, leaseTokenKey, 1)
+		if err != nil {
+			return err
+		}
+		lease.Token = uint64(token)
+		lease.Expires = time.Now().Add(ttl)
+
+		return tx.setLease(name, leaseRecord{Owner: owner, Token: lease.Token}, ttl)
+	})
+
+	return lease, err
+}
+
+// WaitLease is like AcquireLease, but waits until the lease is free if it is
+// held by another owner. Fails with the error of ctx if ctx is done first.
+func (db *DB) WaitLease(ctx context.Context, name, owner string, ttl time.Duration) (Lease, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// wake up when the lease is released or expires
+	events, err := db.Watch(ctx, metaCollection, WatchOptions{Buffer: 1, Types: []EventType{EventDelete, EventExpire}})
+	if err != nil {
+		return Lease{}, err
+	}
+
+	for {
+		lease, err := db.AcquireLease(name, owner, ttl)
+		if err == nil || !errors.Is(err, ErrLeaseHeld) {
+			return lease, err
+		}
+
+		// the lease can be acquired once it has expired, even if the
+		// expired key has not been removed yet
+		wait := time.Second
+		if held, err := db.leaseTTL(name); err == nil && held < wait {
+			wait = held
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Lease{}, ctx.Err()
+		case <-events:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Renew extends the lease to expire after ttl from now. Fails with
+// ErrLeaseLost if the lease expired or was acquired by another owner.
+func (l *Lease) Renew(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: lease ttl must be positive", ErrInvalidConfig)
+	}
+
+	return l.db.Tx(func(tx *Tx) error {
+		if err := tx.checkLease(l); err != nil {
+			return err
+		}
+
+		l.Expires = time.Now().Add(ttl)
+		return tx.setLease(l.Name, leaseRecord{Owner: l.Owner, Token: l.Token}, ttl)
+	})
+}
+
+// Release releases the lease so others can acquire it. Fails with
+// ErrLeaseLost if the lease expired or was acquired by another owner.
+func (l *Lease) Release() error {
+	return l.db.Tx(func(tx *Tx) error {
+		if err := tx.checkLease(l); err != nil {
+			return err
+		}
+
+		return tx.Delete(metaCollection, leasePrefix+l.Name)
+	})
+}
+
+// leaseTTL returns the remaining time to live of the lease on a named
+// resource.
+func (db *DB) leaseTTL(name string) (time.Duration, error) {
+	return db.TTLInCollection(metaCollection, leasePrefix+name)
+}
+
+// lease reads the lease on a named resource.
+func (tx *Tx) lease(name string) (leaseRecord, error) {
+	var record leaseRecord
+
+	value, err := tx.get(metaCollection, leasePrefix+name)
+	if err != nil {
+		return record, err
+	}
+
+	err = json.Unmarshal([]byte(value), &record)
+	return record, err
+}
+
+// setLease stores the lease on a named resource.
+func (tx *Tx) setLease(name string, record leaseRecord, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return tx.set(metaCollection, leasePrefix+name, string(value), expiryOptions(ttl))
+}
+
+// checkLease checks that l is still the current lease on its resource.
+func (tx *Tx) checkLease(l *Lease) error {
+	held, err := tx.lease(l.Name)
+	if err == ErrNotFound || (err == nil && (held.Owner != l.Owner || held.Token != l.Token)) {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, l.Name)
+	}
+
+	return err
+}
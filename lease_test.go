@@ -0,0 +1,135 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test AcquireLease, Renew and Release
+func TestLease(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	lease, err := db.AcquireLease("reports", "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireLease() = %v", err)
+	}
+
+	if _, err := db.AcquireLease("reports", "worker-2", time.Minute); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease() = %v, want %v", err, ErrLeaseHeld)
+	}
+
+	if err := lease.Renew(time.Hour); err != nil {
+		t.Errorf("Renew() = %v", err)
+	}
+
+	if ttl, _ := db.leaseTTL("reports"); ttl <= time.Minute {
+		t.Errorf("leaseTTL() = %v, want about %v", ttl, time.Hour)
+	}
+
+	if err := lease.Release(); err != nil {
+		t.Errorf("Release() = %v", err)
+	}
+
+	if err := lease.Release(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Release() = %v, want %v", err, ErrLeaseLost)
+	}
+
+	next, err := db.AcquireLease("reports", "worker-2", time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireLease() = %v", err)
+	}
+
+	if next.Token <= lease.Token {
+		t.Errorf("AcquireLease().Token = %v, want more than %v", next.Token, lease.Token)
+	}
+
+	if err := lease.Renew(time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Renew() = %v, want %v", err, ErrLeaseLost)
+	}
+
+	// leases are not part of any collection
+	if names, _ := db.ListCollections(); len(names) != 0 {
+		t.Errorf("ListCollections() = %v, want none", names)
+	}
+}
+
+// Test an expired lease can be acquired by another owner
+func TestLeaseExpired(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	lease, _ := db.AcquireLease("reports", "worker-1", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := db.AcquireLease("reports", "worker-2", time.Minute); err != nil {
+		t.Errorf("AcquireLease() = %v", err)
+	}
+
+	if err := lease.Renew(time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Renew() = %v, want %v", err, ErrLeaseLost)
+	}
+}
+
+// Test WaitLease waits for the lease to be released or to expire
+func TestWaitLease(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	lease, _ := db.AcquireLease("reports", "worker-1", time.Minute)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lease.Release()
+	}()
+
+	waited, err := db.WaitLease(context.Background(), "reports", "worker-2", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitLease() = %v", err)
+	}
+
+	if waited.Owner != "worker-2" {
+		t.Errorf("WaitLease().Owner = %v, want %v", waited.Owner, "worker-2")
+	}
+
+	// the lease of worker-2 expires
+	start := time.Now()
+	if _, err := db.WaitLease(context.Background(), "reports", "worker-3", time.Minute); err != nil {
+		t.Errorf("WaitLease() = %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("WaitLease() took %v, want about %v", d, 100*time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.WaitLease(ctx, "reports", "worker-4", time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("WaitLease() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// Test fencing tokens keep increasing after a restart
+func TestLeaseRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lease.db")
+
+	db := NewBuntDb(WithMode("file"), WithFile(file))
+	lease, _ := db.AcquireLease("reports", "worker-1", time.Minute)
+	db.Close()
+
+	db = NewBuntDb(WithMode("file"), WithFile(file))
+	defer db.Close()
+
+	if _, err := db.AcquireLease("reports", "worker-2", time.Minute); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease() = %v, want %v", err, ErrLeaseHeld)
+	}
+
+	lease.db = db
+	lease.Release()
+
+	next, _ := db.AcquireLease("reports", "worker-2", time.Minute)
+	if next.Token <= lease.Token {
+		t.Errorf("AcquireLease().Token = %v, want more than %v", next.Token, lease.Token)
+	}
+}
@@ -0,0 +1,222 @@
+package swmemdb
+
+import (
+	"fmt"
+	"strings"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// CollectionStats describes the contents of a collection.
+type CollectionStats struct {
+	// Keys is the number of keys in the collection. A hash, list or set
+	// counts as a single key.
+	Keys int
+	// ValueBytes is the total size of all values in bytes, including the
+	// elements of hashes, lists and sets.
+	ValueBytes int64
+	// KeysWithTTL is the number of keys that expire.
+	KeysWithTTL int
+	// CompressedKeys is the number of compressed values.
+	CompressedKeys int
+	// BytesSaved is the number of bytes saved by compressing values.
+	BytesSaved int64
+}
+
+// ListCollections returns the names of all collections holding at least one
+// key, in ascending order. The name of a collection is the part of its keys
+// before the first ':'.
+func (db *DB) ListCollections() ([]string, error) {
+	var names []string
+
+	err := db.db.View(func(tx *bunt.Tx) error {
+		pivot := ""
+		for {
+			var next string
+			var found bool
+
+			err := tx.AscendGreaterOrEqual("", pivot, func(key, value string) bool {
+				found = true
+
+				i := strings.IndexByte(key, ':')
+				if i < 0 {
+					// not part of a collection, continue after it
+					next = key + "\x00"
+					return false
+				}
+
+				if key[:i] != metaCollection {
+					names = append(names, key[:i])
+				}
+				// skip to the first key after the collection
+				next = key[:i] + ";"
+				return false
+			})
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				return nil
+			}
+			pivot = next
+		}
+	})
+
+	return names, err
+}
+
+// DropCollection atomically deletes all keys of a collection.
+func (db *DB) DropCollection(name string) error {
+	return db.Tx(func(tx *Tx) error {
+		keys, err := tx.keys(name, true)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			// elements of a structure may be deleted with it already
+			if err := tx.Delete(name, key); err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RenameCollection atomically moves all keys of collection from to
+// collection to, keeping their expiration. It fails with
+// ErrCollectionNotFound if from is empty and with ErrCollectionExists if to
+// already holds keys.
+func (db *DB) RenameCollection(from, to string) error {
+	return db.Tx(func(tx *Tx) error {
+		return tx.copyCollection(from, to, true)
+	})
+}
+
+// CopyCollection atomically copies all keys of collection src to collection
+// dst, keeping their expiration. It fails with ErrCollectionNotFound if src
+// is empty and with ErrCollectionExists if dst already holds keys.
+func (db *DB) CopyCollection(src, dst string) error {
+	return db.Tx(func(tx *Tx) error {
+		return tx.copyCollection(src, dst, false)
+	})
+}
+
+// CollectionStats returns statistics about a collection.
+func (db *DB) CollectionStats(name string) (CollectionStats, error) {
+	var stats CollectionStats
+
+	err := db.db.View(func(tx *bunt.Tx) error {
+		var keys []string
+		var decodeErr error
+
+		err := tx.AscendKeys(collectionPattern(name), func(key, value string) bool {
+			// elements of structures count towards the size of their values
+			if !isElementKey(key[len(name)+1:]) {
+				keys = append(keys, key)
+				stats.Keys++
+			}
+			stats.ValueBytes += int64(len(value))
+
+			compressed, err := decrypt(db.cipher.Load(), value)
+			if err != nil {
+				decodeErr = err
+				return false
+			}
+
+			_, size, _, ok, err := parseCompressed(compressed)
+			if err != nil {
+				decodeErr = err
+				return false
+			}
+			if ok {
+				stats.CompressedKeys++
+				stats.BytesSaved += int64(size - len(compressed))
+			}
+
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if decodeErr != nil {
+			return decodeErr
+		}
+
+		for _, key := range keys {
+			ttl, err := tx.TTL(key)
+			if err == nil && ttl >= 0 {
+				stats.KeysWithTTL++
+			}
+		}
+
+		return nil
+	})
+
+	return stats, err
+}
+
+// copyCollection copies all keys of src to dst, deleting them from src if
+// move is set.
+func (tx *Tx) copyCollection(src, dst string, move bool) error {
+	if src == dst {
+		return fmt.Errorf("%w: %s", ErrCollectionExists, dst)
+	}
+
+	existing, err := tx.Keys(dst)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("%w: %s", ErrCollectionExists, dst)
+	}
+
+	keys, err := tx.keys(src, true)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, src)
+	}
+
+	for _, key := range keys {
+		srcKey := collectionKey(src, key)
+
+		stored, err := tx.tx.Get(srcKey)
+		if err == ErrNotFound {
+			// expired while copying
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		ttl, err := tx.tx.TTL(srcKey)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		value, err := tx.db.decodeValue(stored)
+		if err != nil {
+			return err
+		}
+
+		// copy the stored value as is, it is already encoded
+		if err := tx.setStoredKey(collectionKey(dst, key), dst, key, stored, value, expiryOptions(ttl)); err != nil {
+			return err
+		}
+
+		// the elements of structures are moved as keys of their own, so
+		// deleting a header must not delete them too
+		if move {
+			if err := tx.delete(src, key, EventDelete); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
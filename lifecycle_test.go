@@ -0,0 +1,209 @@
+package swmemdb
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// lifecycleTestDb fills db with a few collections.
+func lifecycleTestDb(t *testing.T, db *DB) {
+	err := db.Tx(func(tx *Tx) error {
+		for _, kv := range [][3]string{
+			{"users", "alice", "1"},
+			{"users", "bob", "22"},
+			{"orders", "1", "333"},
+			{"carts", "alice", "4444"},
+		} {
+			if err := tx.Set(kv[0], kv[1], kv[2]); err != nil {
+				return err
+			}
+		}
+		return tx.Set("users", "carol", "55555", time.Minute)
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+}
+
+// Test ListCollections
+func TestListCollections(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	names, err := db.ListCollections()
+	if err != nil {
+		t.Errorf("ListCollections() = %v, want %v", err, "nil")
+	}
+
+	if len(names) != 0 {
+		t.Errorf("ListCollections() = %v, want %v", names, "[]")
+	}
+
+	lifecycleTestDb(t, db)
+
+	names, err = db.ListCollections()
+	if err != nil {
+		t.Errorf("ListCollections() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"carts", "orders", "users"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListCollections() = %v, want %v", names, want)
+	}
+}
+
+// Test DropCollection
+func TestDropCollection(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	lifecycleTestDb(t, db)
+
+	err := db.DropCollection("users")
+	if err != nil {
+		t.Errorf("DropCollection() = %v, want %v", err, "nil")
+	}
+
+	names, err := db.ListCollections()
+	if err != nil {
+		t.Errorf("ListCollections() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"carts", "orders"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListCollections() = %v, want %v", names, want)
+	}
+}
+
+// Test RenameCollection in file mode
+func TestRenameCollection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rename.db")
+	db := NewBuntDb(WithFile(file), WithMode("file"))
+	lifecycleTestDb(t, db)
+
+	err := db.RenameCollection("users", "people")
+	if err != nil {
+		t.Errorf("RenameCollection() = %v, want %v", err, "nil")
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Errorf("Close() = %v, want %v", err, "nil")
+	}
+
+	// reopen to check the rename was persisted
+	db = NewBuntDb(WithFile(file), WithMode("file"))
+	defer db.Close()
+
+	keys, err := db.GetKeysFromCollection("users")
+	if err != nil {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if len(keys) != 0 {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, "[]")
+	}
+
+	stats, err := db.CollectionStats("people")
+	if err != nil {
+		t.Errorf("CollectionStats() = %v, want %v", err, "nil")
+	}
+
+	if want := (CollectionStats{Keys: 3, ValueBytes: 8, KeysWithTTL: 1}); stats != want {
+		t.Errorf("CollectionStats() = %v, want %v", stats, want)
+	}
+}
+
+// Test CopyCollection
+func TestCopyCollection(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	lifecycleTestDb(t, db)
+
+	err := db.CopyCollection("users", "backup")
+	if err != nil {
+		t.Errorf("CopyCollection() = %v, want %v", err, "nil")
+	}
+
+	for _, name := range []string{"users", "backup"} {
+		stats, err := db.CollectionStats(name)
+		if err != nil {
+			t.Errorf("CollectionStats() = %v, want %v", err, "nil")
+		}
+
+		if want := (CollectionStats{Keys: 3, ValueBytes: 8, KeysWithTTL: 1}); stats != want {
+			t.Errorf("CollectionStats(%s) = %v, want %v", name, stats, want)
+		}
+	}
+}
+
+// Test that renaming and copying refuse to overwrite or copy nothing
+func TestCopyCollectionErrors(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	lifecycleTestDb(t, db)
+
+	err := db.CopyCollection("users", "orders")
+	if !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("CopyCollection() = %v, want %v", err, ErrCollectionExists)
+	}
+
+	err = db.RenameCollection("missing", "other")
+	if !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("RenameCollection() = %v, want %v", err, ErrCollectionNotFound)
+	}
+
+	stats, err := db.CollectionStats("users")
+	if err != nil {
+		t.Errorf("CollectionStats() = %v, want %v", err, "nil")
+	}
+
+	if stats.Keys != 3 {
+		t.Errorf("CollectionStats() = %v, want %v", stats.Keys, 3)
+	}
+}
+
+// Test renaming and copying collections holding structures
+func TestRenameCollectionStructures(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	if err := db.HSet("src", "h", "f", "v"); err != nil {
+		t.Fatalf("HSet() = %v, want %v", err, "nil")
+	}
+	if _, err := db.RPush("src", "l", "a", "b"); err != nil {
+		t.Fatalf("RPush() = %v, want %v", err, "nil")
+	}
+	if _, err := db.SAdd("src", "s", "x", "y"); err != nil {
+		t.Fatalf("SAdd() = %v, want %v", err, "nil")
+	}
+
+	if err := db.CopyCollection("src", "copy"); err != nil {
+		t.Errorf("CopyCollection() = %v, want %v", err, "nil")
+	}
+	if err := db.RenameCollection("src", "dst"); err != nil {
+		t.Errorf("RenameCollection() = %v, want %v", err, "nil")
+	}
+
+	for _, name := range []string{"copy", "dst"} {
+		fields, err := db.HGetAll(name, "h")
+		if want := map[string]string{"f": "v"}; err != nil || !reflect.DeepEqual(fields, want) {
+			t.Errorf("HGetAll(%s) = %v, %v, want %v", name, fields, err, want)
+		}
+
+		values, err := db.LRange(name, "l", 0, -1)
+		if want := []string{"a", "b"}; err != nil || !reflect.DeepEqual(values, want) {
+			t.Errorf("LRange(%s) = %v, %v, want %v", name, values, err, want)
+		}
+
+		members, err := db.SMembers(name, "s")
+		if want := []string{"x", "y"}; err != nil || !reflect.DeepEqual(members, want) {
+			t.Errorf("SMembers(%s) = %v, %v, want %v", name, members, err, want)
+		}
+	}
+
+	fields, err := db.HGetAll("src", "h")
+	if err != nil || len(fields) != 0 {
+		t.Errorf("HGetAll(src) = %v, %v, want %v", fields, err, "map[]")
+	}
+}
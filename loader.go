@@ -0,0 +1,216 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// loadErrorPrefix prefixes the keys of cached load errors in metaCollection.
+const loadErrorPrefix = "load-error:"
+
+// errLoaderPanicked is returned to the callers waiting for a load whose
+// loader panicked.
+var errLoaderPanicked = errors.New("swmemdb: loader panicked")
+
+// LoadOption configures GetOrLoad.
+type LoadOption func(o *loadOptions)
+
+// loadOptions configures GetOrLoad.
+type loadOptions struct {
+	stale    time.Duration
+	errorTTL time.Duration
+}
+
+// StaleWhileRevalidate keeps loaded values for d after their time to live.
+// During that time the stale value is returned at once while it is loaded
+// again in the background.
+func StaleWhileRevalidate(d time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.stale = d
+	}
+}
+
+// CacheErrors caches failed loads for ttl. Until then GetOrLoad fails with
+// ErrLoadFailed without calling the loader.
+func CacheErrors(ttl time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.errorTTL = ttl
+	}
+}
+
+// GetOrLoad gets the value for a key in a collection. If the key does not
+// exist, the value is loaded by calling loader and stored with the given
+// time to live; a zero or negative ttl never expires. Concurrent calls for
+// the same key share a single call of loader, made with the values of the
+// context of the first caller but not its cancellation, so the load goes on
+// for the others when the first caller gives up. Every caller stops waiting
+// when its own context is done, and fails if loader panics.
+func (db *DB) GetOrLoad(ctx context.Context, collection, key string, ttl time.Duration, loader func(ctx context.Context) (string, error), options ...LoadOption) (string, error) {
+	var o loadOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	value, fresh, err := db.cached(ctx, collection, key, o)
+	if err == nil {
+		if !fresh {
+			// revalidate in the background, unless already loading
+			go func() {
+				// a panicking loader has no caller to handle it here
+				defer func() { recover() }()
+
+				db.loads.do(context.Background(), collectionKey(collection, key), func() (string, error) {
+					return db.load(context.Background(), collection, key, ttl, loader, o, true)
+				})
+			}()
+		}
+		return value, nil
+	} else if err != ErrNotFound {
+		return "", err
+	}
+
+	return db.loads.do(ctx, collectionKey(collection, key), func() (string, error) {
+		// the load is shared, the first caller must not cancel it
+		ctx := withoutCancel(ctx)
+
+		// the value may have been loaded while waiting
+		if value, _, err := db.cached(ctx, collection, key, o); err != ErrNotFound {
+			return value, err
+		}
+
+		return db.load(ctx, collection, key, ttl, loader, o, false)
+	})
+}
+
+// cached gets the value for a key in a collection and reports whether it is
+// fresh. Fails with ErrLoadFailed if the last load failed and its error is
+// cached.
+func (db *DB) cached(ctx context.Context, collection, key string, o loadOptions) (value string, fresh bool, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) error {
+		var err error
+		if value, err = tx.get(collection, key); err == nil {
+			ttl, err := tx.TTL(collection, key)
+			fresh = o.stale <= 0 || ttl == NoExpiration || ttl > o.stale
+			return err
+		} else if err != ErrNotFound || o.errorTTL <= 0 {
+			return err
+		}
+
+		msg, err := tx.get(metaCollection, loadErrorKey(collection, key))
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: %s", ErrLoadFailed, msg)
+	})
+
+	return value, fresh, err
+}
+
+// load calls loader and stores the value, or the error if errors are cached.
+// Errors are not cached when revalidating, the stale value stays until it
+// expires.
+func (db *DB) load(ctx context.Context, collection, key string, ttl time.Duration, loader func(ctx context.Context) (string, error), o loadOptions, revalidate bool) (string, error) {
+	value, err := loader(ctx)
+	if err != nil {
+		if o.errorTTL > 0 && !revalidate {
+			db.SetToCollectionCtx(ctx, metaCollection, loadErrorKey(collection, key), err.Error(), o.errorTTL)
+		}
+		return "", err
+	}
+
+	if ttl > 0 {
+		ttl += o.stale
+	}
+
+	return value, db.SetToCollectionCtx(ctx, collection, key, value, ttl)
+}
+
+// loadErrorKey returns the key in metaCollection of the cached load error
+// of a key in a collection.
+func loadErrorKey(collection, key string) string {
+	return loadErrorPrefix + collectionKey(collection, key)
+}
+
+// loadCall is a call of a loader shared by concurrent callers.
+type loadCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// loadGroup coalesces concurrent loads of the same key.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+// do calls fn unless a call for key is in progress, in which case it waits
+// for that call until ctx is done, and returns its result.
+func (g *loadGroup) do(ctx context.Context, key string, fn func() (string, error)) (string, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+
+		select {
+		case <-c.done:
+			return c.value, c.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	c := &loadCall{done: make(chan struct{})}
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	returned := false
+	defer func() {
+		// fail the waiters if fn panicked, the panic goes on in the caller
+		if !returned {
+			c.value, c.err = "", errLoaderPanicked
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn()
+	returned = true
+
+	return c.value, c.err
+}
+
+// detachedContext carries the values of a context without its cancellation
+// and deadline.
+type detachedContext struct {
+	context.Context
+}
+
+// withoutCancel returns a context with the values of ctx that is never done.
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+// Deadline reports that the context has no deadline.
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done returns nil, the context is never done.
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err returns nil, the context is never done.
+func (detachedContext) Err() error {
+	return nil
+}
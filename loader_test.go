@@ -0,0 +1,251 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test GetOrLoad loads missing keys once
+func TestGetOrLoad(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "loaded", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := db.GetOrLoad(context.Background(), "cache", "a", time.Minute, loader); err != nil || value != "loaded" {
+				t.Errorf("GetOrLoad() = %v, %v, want %v", value, err, "loaded")
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %v times, want %v", n, 1)
+	}
+
+	if ttl, _ := db.TTLInCollection("cache", "a"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTLInCollection() = %v, want about %v", ttl, time.Minute)
+	}
+
+	// cached values are returned without loading
+	db.GetOrLoad(context.Background(), "cache", "a", time.Minute, loader)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %v times, want %v", n, 1)
+	}
+}
+
+// Test waiting callers stop when their context is done
+func TestGetOrLoadContext(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	go db.GetOrLoad(context.Background(), "cache", "a", time.Minute, func(ctx context.Context) (string, error) {
+		<-release
+		return "loaded", nil
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := db.GetOrLoad(ctx, "cache", "a", time.Minute, func(ctx context.Context) (string, error) {
+		t.Error("loader called while another load is in progress")
+		return "", nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("GetOrLoad() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// Test StaleWhileRevalidate returns stale values while loading again
+func TestGetOrLoadStale(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	var calls atomic.Int32
+	loaded := make(chan struct{}, 1)
+	loader := func(ctx context.Context) (string, error) {
+		n := calls.Add(1)
+		defer func() { loaded <- struct{}{} }()
+		if n == 1 {
+			return "old", nil
+		}
+		return "new", nil
+	}
+
+	ctx := context.Background()
+	db.GetOrLoad(ctx, "cache", "a", 50*time.Millisecond, loader, StaleWhileRevalidate(time.Minute))
+	<-loaded
+
+	time.Sleep(100 * time.Millisecond)
+	if value, _ := db.GetOrLoad(ctx, "cache", "a", 50*time.Millisecond, loader, StaleWhileRevalidate(time.Minute)); value != "old" {
+		t.Errorf("GetOrLoad() = %v, want %v", value, "old")
+	}
+
+	select {
+	case <-loaded:
+	case <-time.After(time.Second):
+		t.Fatal("value not revalidated")
+	}
+
+	waitFor(t, "the revalidated value", func() bool {
+		value, _ := db.GetFromCollection("cache", "a")
+		return value == "new"
+	})
+}
+
+// Test CacheErrors caches failed loads
+func TestGetOrLoadCacheErrors(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	failure := errors.New("service unavailable")
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		return "", failure
+	}
+
+	ctx := context.Background()
+	if _, err := db.GetOrLoad(ctx, "cache", "a", time.Minute, loader, CacheErrors(50*time.Millisecond)); err != failure {
+		t.Errorf("GetOrLoad() = %v, want %v", err, failure)
+	}
+
+	if _, err := db.GetOrLoad(ctx, "cache", "a", time.Minute, loader, CacheErrors(50*time.Millisecond)); !errors.Is(err, ErrLoadFailed) {
+		t.Errorf("GetOrLoad() = %v, want %v", err, ErrLoadFailed)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %v times, want %v", n, 1)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	db.GetOrLoad(ctx, "cache", "a", time.Minute, loader, CacheErrors(50*time.Millisecond))
+	if n := calls.Load(); n != 2 {
+		t.Errorf("loader called %v times, want %v", n, 2)
+	}
+
+	// errors are not cached without CacheErrors
+	db.GetOrLoad(ctx, "cache", "b", time.Minute, loader)
+	db.GetOrLoad(ctx, "cache", "b", time.Minute, loader)
+	if n := calls.Load(); n != 4 {
+		t.Errorf("loader called %v times, want %v", n, 4)
+	}
+}
+
+// Test callers waiting for a panicking loader fail
+func TestGetOrLoadPanic(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	release := make(chan struct{})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		db.GetOrLoad(context.Background(), "cache", "a", time.Minute, func(ctx context.Context) (string, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		_, err := db.GetOrLoad(context.Background(), "cache", "a", time.Minute, func(ctx context.Context) (string, error) {
+			return "loaded", nil
+		})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if r := <-panicked; r != "boom" {
+		t.Errorf("recover() = %v, want %v", r, "boom")
+	}
+
+	if err := <-done; err != errLoaderPanicked {
+		t.Errorf("GetOrLoad() = %v, want %v", err, errLoaderPanicked)
+	}
+}
+
+// Test a loader panicking while revalidating does not crash the process
+func TestGetOrLoadRevalidatePanic(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	ctx := context.Background()
+	db.GetOrLoad(ctx, "cache", "a", 10*time.Millisecond, func(ctx context.Context) (string, error) {
+		return "old", nil
+	}, StaleWhileRevalidate(time.Minute))
+
+	time.Sleep(50 * time.Millisecond)
+	revalidated := make(chan struct{})
+	value, err := db.GetOrLoad(ctx, "cache", "a", 10*time.Millisecond, func(ctx context.Context) (string, error) {
+		close(revalidated)
+		panic("boom")
+	}, StaleWhileRevalidate(time.Minute))
+	if err != nil || value != "old" {
+		t.Errorf("GetOrLoad() = %v, %v, want %v", value, err, "old")
+	}
+
+	<-revalidated
+	time.Sleep(20 * time.Millisecond)
+	if value, _ := db.GetFromCollection("cache", "a"); value != "old" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "old")
+	}
+}
+
+// Test the first caller giving up does not cancel the load for the others
+func TestGetOrLoadFirstCallerCancel(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	release := make(chan struct{})
+	first, cancel := context.WithCancel(context.Background())
+	go db.GetOrLoad(first, "cache", "a", time.Minute, func(ctx context.Context) (string, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "loaded", nil
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan string)
+	go func() {
+		value, err := db.GetOrLoad(context.Background(), "cache", "a", time.Minute, func(ctx context.Context) (string, error) {
+			return "", errors.New("loader called twice")
+		})
+		if err != nil {
+			t.Errorf("GetOrLoad() = %v, want %v", err, "nil")
+		}
+		done <- value
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	close(release)
+
+	if value := <-done; value != "loaded" {
+		t.Errorf("GetOrLoad() = %v, want %v", value, "loaded")
+	}
+}
@@ -0,0 +1,346 @@
+package swmemdb
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operations recorded by the metrics.
+const (
+	OpGet    = "get"
+	OpSet    = "set"
+	OpDelete = "delete"
+)
+
+// metricOps are the recorded operations, indexed by opGet, opSet and
+// opDelete.
+var metricOps = [...]string{OpGet, OpSet, OpDelete}
+
+// indexes into metricOps
+const (
+	opGet = iota
+	opSet
+	opDelete
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms.
+var LatencyBuckets = [...]time.Duration{
+	time.Microsecond,
+	5 * time.Microsecond,
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// WithMetrics records per-collection operation counts, errors, latencies,
+// hits, misses and expirations, see DB.Stats and NewMetricsHandler.
+func WithMetrics() BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.metrics = true
+	}
+}
+
+// Stats describes the behaviour of a database.
+type Stats struct {
+	// Collections holds the metrics of every collection.
+	Collections map[string]CollectionMetrics
+	// AOFSize is the size of the database file in bytes, zero in memory
+	// mode.
+	AOFSize int64
+}
+
+// CollectionMetrics describes the behaviour of a collection.
+type CollectionMetrics struct {
+	// Keys is the number of keys in the collection.
+	Keys int
+	// Ops holds the metrics of every operation, keyed by OpGet, OpSet and
+	// OpDelete.
+	Ops map[string]OpMetrics
+	// Hits is the number of gets that found a value.
+	Hits uint64
+	// Misses is the number of gets that found no value.
+	Misses uint64
+	// Expirations is the number of keys that expired.
+	Expirations uint64
+}
+
+// OpMetrics describes an operation.
+type OpMetrics struct {
+	// Count is the number of operations.
+	Count uint64
+	// Errors is the number of failed operations. Missing keys are not
+	// counted as errors.
+	Errors uint64
+	// Latency is the distribution of the operation latencies.
+	Latency Histogram
+}
+
+// Histogram is a distribution of latencies over LatencyBuckets.
+type Histogram struct {
+	// Counts holds the number of observations per bucket of
+	// LatencyBuckets, not cumulative, followed by the observations above the
+	// last bucket.
+	Counts []uint64
+	// Sum is the sum of all observations.
+	Sum time.Duration
+}
+
+// metrics records the metrics of a database.
+type metrics struct {
+	mu          sync.RWMutex
+	collections map[string]*collectionMetrics
+}
+
+// collectionMetrics records the metrics of a collection.
+type collectionMetrics struct {
+	ops         [len(metricOps)]opMetrics
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// opMetrics records the metrics of an operation.
+type opMetrics struct {
+	count   atomic.Uint64
+	errors  atomic.Uint64
+	sum     atomic.Int64
+	buckets [len(LatencyBuckets) + 1]atomic.Uint64
+}
+
+// collection returns the metrics of a collection, creating them if needed.
+func (m *metrics) collection(name string) *collectionMetrics {
+	m.mu.RLock()
+	c, ok := m.collections[name]
+	m.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, ok = m.collections[name]; !ok {
+		if m.collections == nil {
+			m.collections = make(map[string]*collectionMetrics)
+		}
+		c = &collectionMetrics{}
+		m.collections[name] = c
+	}
+
+	return c
+}
+
+// metricsStart returns the start time of an operation, or the zero time
+// when metrics are disabled.
+func (db *DB) metricsStart() time.Time {
+	if !db.opts.metrics {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+// observe records an operation on a collection started at start.
+func (db *DB) observe(collection string, op int, start time.Time, err error) {
+	if start.IsZero() {
+		return
+	}
+	d := time.Since(start)
+
+	c := db.metrics.collection(collection)
+	o := &c.ops[op]
+	o.count.Add(1)
+	o.sum.Add(int64(d))
+
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] })
+	o.buckets[i].Add(1)
+
+	if op == opGet {
+		if err == nil {
+			c.hits.Add(1)
+		} else if err == ErrNotFound {
+			c.misses.Add(1)
+		}
+	}
+
+	if err != nil && err != ErrNotFound {
+		o.errors.Add(1)
+	}
+}
+
+// observeExpiration records an expired key of a collection.
+func (db *DB) observeExpiration(collection string) {
+	if db.opts.metrics {
+		db.metrics.collection(collection).expirations.Add(1)
+	}
+}
+
+// Stats returns the metrics of the database. Key counts and the file size
+// are always reported; operation metrics require WithMetrics.
+func (db *DB) Stats() (Stats, error) {
+	stats := Stats{Collections: make(map[string]CollectionMetrics)}
+
+	names, err := db.ListCollections()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, name := range names {
+		keys, err := db.GetKeysFromCollection(name)
+		if err != nil {
+			return stats, err
+		}
+		stats.Collections[name] = CollectionMetrics{Keys: len(keys)}
+	}
+
+	db.metrics.mu.RLock()
+	for name, c := range db.metrics.collections {
+		cm := stats.Collections[name]
+		cm.Hits = c.hits.Load()
+		cm.Misses = c.misses.Load()
+		cm.Expirations = c.expirations.Load()
+		cm.Ops = make(map[string]OpMetrics, len(metricOps))
+
+		for i, op := range metricOps {
+			o := &c.ops[i]
+			h := Histogram{Counts: make([]uint64, len(LatencyBuckets)+1), Sum: time.Duration(o.sum.Load())}
+			for j := range h.Counts {
+				h.Counts[j] = o.buckets[j].Load()
+			}
+			cm.Ops[op] = OpMetrics{Count: o.count.Load(), Errors: o.errors.Load(), Latency: h}
+		}
+
+		stats.Collections[name] = cm
+	}
+	db.metrics.mu.RUnlock()
+
+	if memory, _ := parseMode(db.mode); !memory {
+		info, err := os.Stat(db.file)
+		if err != nil {
+			return stats, err
+		}
+		stats.AOFSize = info.Size()
+	}
+
+	return stats, nil
+}
+
+// NewMetricsHandler returns an http.Handler serving the metrics of db in the
+// Prometheus text exposition format.
+func NewMetricsHandler(db *DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := db.Stats()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writePrometheus(bw, stats)
+		bw.Flush()
+	})
+}
+
+// writePrometheus writes stats in the Prometheus text exposition format.
+func writePrometheus(w *bufio.Writer, stats Stats) {
+	names := make([]string, 0, len(stats.Collections))
+	for name := range stats.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	header := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("swmemdb_keys", "gauge", "Number of keys per collection.")
+	for _, name := range names {
+		fmt.Fprintf(w, "swmemdb_keys{collection=%s} %d\n", promLabel(name), stats.Collections[name].Keys)
+	}
+
+	header("swmemdb_operations_total", "counter", "Number of operations per collection.")
+	for _, name := range names {
+		for _, op := range metricOps {
+			if o, ok := stats.Collections[name].Ops[op]; ok {
+				fmt.Fprintf(w, "swmemdb_operations_total{collection=%s,op=%q} %d\n", promLabel(name), op, o.Count)
+			}
+		}
+	}
+
+	header("swmemdb_operation_errors_total", "counter", "Number of failed operations per collection.")
+	for _, name := range names {
+		for _, op := range metricOps {
+			if o, ok := stats.Collections[name].Ops[op]; ok {
+				fmt.Fprintf(w, "swmemdb_operation_errors_total{collection=%s,op=%q} %d\n", promLabel(name), op, o.Errors)
+			}
+		}
+	}
+
+	header("swmemdb_operation_duration_seconds", "histogram", "Latency of operations per collection.")
+	for _, name := range names {
+		for _, op := range metricOps {
+			o, ok := stats.Collections[name].Ops[op]
+			if !ok {
+				continue
+			}
+
+			labels := fmt.Sprintf("collection=%s,op=%q", promLabel(name), op)
+			var cumulative uint64
+			for i, count := range o.Latency.Counts {
+				cumulative += count
+				le := "+Inf"
+				if i < len(LatencyBuckets) {
+					le = strconv.FormatFloat(LatencyBuckets[i].Seconds(), 'g', -1, 64)
+				}
+				fmt.Fprintf(w, "swmemdb_operation_duration_seconds_bucket{%s,le=%q} %d\n", labels, le, cumulative)
+			}
+			fmt.Fprintf(w, "swmemdb_operation_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(o.Latency.Sum.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(w, "swmemdb_operation_duration_seconds_count{%s} %d\n", labels, cumulative)
+		}
+	}
+
+	header("swmemdb_hits_total", "counter", "Number of gets that found a value.")
+	for _, name := range names {
+		if stats.Collections[name].Ops != nil {
+			fmt.Fprintf(w, "swmemdb_hits_total{collection=%s} %d\n", promLabel(name), stats.Collections[name].Hits)
+		}
+	}
+
+	header("swmemdb_misses_total", "counter", "Number of gets that found no value.")
+	for _, name := range names {
+		if stats.Collections[name].Ops != nil {
+			fmt.Fprintf(w, "swmemdb_misses_total{collection=%s} %d\n", promLabel(name), stats.Collections[name].Misses)
+		}
+	}
+
+	header("swmemdb_expirations_total", "counter", "Number of expired keys.")
+	for _, name := range names {
+		if stats.Collections[name].Ops != nil {
+			fmt.Fprintf(w, "swmemdb_expirations_total{collection=%s} %d\n", promLabel(name), stats.Collections[name].Expirations)
+		}
+	}
+
+	header("swmemdb_aof_size_bytes", "gauge", "Size of the database file.")
+	fmt.Fprintf(w, "swmemdb_aof_size_bytes %d\n", stats.AOFSize)
+}
+
+// promLabel quotes a Prometheus label value.
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
@@ -0,0 +1,155 @@
+package swmemdb
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test Stats records operations per collection
+func TestStats(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithMetrics())
+	defer db.Close()
+
+	db.SetToCollection("users", "alice", "1")
+	db.SetToCollection("users", "bob", "2")
+	db.GetFromCollection("users", "alice")
+	db.GetFromCollection("users", "carol")
+	db.DeleteFromCollection("users", "bob")
+	db.SetToCollection("sessions", "1", "x", 10*time.Millisecond)
+
+	time.Sleep(1500 * time.Millisecond)
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats() = %v, want %v", err, "nil")
+	}
+
+	users := stats.Collections["users"]
+	if users.Keys != 1 {
+		t.Errorf("Keys = %v, want %v", users.Keys, 1)
+	}
+
+	if users.Ops[OpSet].Count != 2 || users.Ops[OpGet].Count != 2 || users.Ops[OpDelete].Count != 1 {
+		t.Errorf("Ops = %+v, want 2 sets, 2 gets and 1 delete", users.Ops)
+	}
+
+	if users.Hits != 1 || users.Misses != 1 {
+		t.Errorf("Hits, Misses = %v, %v, want %v, %v", users.Hits, users.Misses, 1, 1)
+	}
+
+	if users.Ops[OpGet].Errors != 0 {
+		t.Errorf("Errors = %v, want %v", users.Ops[OpGet].Errors, 0)
+	}
+
+	var observed uint64
+	for _, count := range users.Ops[OpSet].Latency.Counts {
+		observed += count
+	}
+	if observed != 2 || users.Ops[OpSet].Latency.Sum <= 0 {
+		t.Errorf("Latency = %+v, want 2 observations", users.Ops[OpSet].Latency)
+	}
+
+	if sessions := stats.Collections["sessions"]; sessions.Expirations != 1 {
+		t.Errorf("Expirations = %v, want %v", sessions.Expirations, 1)
+	}
+
+	if stats.AOFSize != 0 {
+		t.Errorf("AOFSize = %v, want %v", stats.AOFSize, 0)
+	}
+}
+
+// Test reads the database makes itself are not counted as gets
+func TestStatsInternalReads(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithMetrics())
+	defer db.Close()
+
+	err := db.Tx(func(tx *Tx) error {
+		if _, err := tx.Incr("users", "n", 1); err != nil {
+			return err
+		}
+		if err := tx.Expire("users", "n", time.Hour); err != nil {
+			return err
+		}
+		if err := tx.Persist("users", "n"); err != nil {
+			return err
+		}
+		if _, err := tx.RPush("users", "l", "a", "b"); err != nil {
+			return err
+		}
+		_, err := tx.LRange("users", "l", 0, -1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+
+	loader := func(ctx context.Context) (string, error) { return "1", nil }
+	db.GetOrLoad(context.Background(), "users", "alice", 0, loader)
+	db.GetOrLoad(context.Background(), "users", "alice", 0, loader)
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats() = %v, want %v", err, "nil")
+	}
+
+	if users := stats.Collections["users"]; users.Ops[OpGet].Count != 0 || users.Hits != 0 || users.Misses != 0 {
+		t.Errorf("Collections[users] = %+v, want no gets", users)
+	}
+}
+
+// Test Stats without WithMetrics reports key counts and the file size
+func TestStatsDisabled(t *testing.T) {
+	db := NewBuntDb(WithMode("file"), WithFile(filepath.Join(t.TempDir(), "stats.db")))
+	defer db.Close()
+
+	db.SetToCollection("users", "alice", "1")
+	db.GetFromCollection("users", "alice")
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats() = %v, want %v", err, "nil")
+	}
+
+	if users := stats.Collections["users"]; users.Keys != 1 || users.Ops != nil {
+		t.Errorf("Collections[users] = %+v, want 1 key and no operations", users)
+	}
+
+	if stats.AOFSize <= 0 {
+		t.Errorf("AOFSize = %v, want > 0", stats.AOFSize)
+	}
+}
+
+// Test NewMetricsHandler
+func TestMetricsHandler(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithMetrics())
+	defer db.Close()
+
+	db.SetToCollection(`we"ird`, "alice", "1")
+	db.GetFromCollection(`we"ird`, "alice")
+
+	rec := httptest.NewRecorder()
+	NewMetricsHandler(db).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %v, want %v", ct, "text/plain")
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE swmemdb_operation_duration_seconds histogram\n",
+		`swmemdb_keys{collection="we\"ird"} 1` + "\n",
+		`swmemdb_operations_total{collection="we\"ird",op="get"} 1` + "\n",
+		`swmemdb_operation_duration_seconds_bucket{collection="we\"ird",op="set",le="+Inf"} 1` + "\n",
+		`swmemdb_operation_duration_seconds_count{collection="we\"ird",op="set"} 1` + "\n",
+		`swmemdb_hits_total{collection="we\"ird"} 1` + "\n",
+		"swmemdb_aof_size_bytes 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+}
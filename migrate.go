@@ -0,0 +1,194 @@
+package swmemdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// migrationPrefix prefixes the keys of applied migrations in metaCollection.
+const migrationPrefix = "migration:"
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("swmemdb: dry run")
+
+// Migration changes the data of a collection. Migrations are identified by
+// their ID and applied at most once.
+type Migration struct {
+	// ID identifies the migration, e.g. "0001-split-names".
+	ID string
+	// Collection is the collection the migration changes.
+	Collection string
+	// Up applies the migration. Any error rolls back the changes.
+	Up func(tx *Tx) error
+}
+
+// MigrationResult describes a migration run by Migrate or MigrateDryRun.
+type MigrationResult struct {
+	// ID is the ID of the migration.
+	ID string
+	// Skipped reports whether the migration had already been applied.
+	Skipped bool
+	// Changed is the number of keys the migration set to a different value
+	// or deleted.
+	Changed int
+}
+
+// appliedMigration is the record of an applied migration.
+type appliedMigration struct {
+	Collection string    `json:"collection"`
+	AppliedAt  time.Time `json:"applied_at"`
+}
+
+// WithMigrations applies the given migrations whenever the database is
+// opened, see DB.Migrate. Replicas skip them, they receive the changes from
+// the primary.
+func WithMigrations(migrations ...Migration) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.migrations = append(o.migrations, migrations...)
+	}
+}
+
+// Migrate applies the migrations that have not been applied yet, in order.
+// Each migration runs in its own transaction together with the record of
+// it in the reserved _meta collection, so it is applied exactly once or not
+// at all. Migrate stops at the first failing migration and returns the
+// results so far.
+func (db *DB) Migrate(migrations []Migration) ([]MigrationResult, error) {
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	var results []MigrationResult
+	for _, m := range migrations {
+		result := MigrationResult{ID: m.ID}
+
+		err := db.Tx(func(tx *Tx) error {
+			applied, err := tx.migrationApplied(m.ID)
+			if err != nil || applied {
+				result.Skipped = applied
+				return err
+			}
+
+			return tx.migrate(m, &result)
+		})
+		if err != nil {
+			return results, fmt.Errorf("migration %s: %w", m.ID, err)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// MigrateDryRun runs the migrations that have not been applied yet like
+// Migrate and reports how many keys each would change, then rolls back all
+// changes.
+func (db *DB) MigrateDryRun(migrations []Migration) ([]MigrationResult, error) {
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	var results []MigrationResult
+	err := db.Tx(func(tx *Tx) error {
+		for _, m := range migrations {
+			result := MigrationResult{ID: m.ID}
+
+			applied, err := tx.migrationApplied(m.ID)
+			if err != nil {
+				return err
+			}
+
+			if applied {
+				result.Skipped = true
+			} else if err := tx.migrate(m, &result); err != nil {
+				return fmt.Errorf("migration %s: %w", m.ID, err)
+			}
+
+			results = append(results, result)
+		}
+
+		return errDryRun
+	})
+	if err != errDryRun {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// AppliedMigrations returns the IDs of all applied migrations in ascending
+// order.
+func (db *DB) AppliedMigrations() ([]string, error) {
+	var ids []string
+
+	err := db.View(func(tx *Tx) error {
+		keys, err := tx.Keys(metaCollection)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if len(key) > len(migrationPrefix) && key[:len(migrationPrefix)] == migrationPrefix {
+				ids = append(ids, key[len(migrationPrefix):])
+			}
+		}
+
+		return nil
+	})
+	sort.Strings(ids)
+
+	return ids, err
+}
+
+// migrationApplied reports whether the migration with the given ID has been
+// applied.
+func (tx *Tx) migrationApplied(id string) (bool, error) {
+	_, err := tx.tx.Get(collectionKey(metaCollection, migrationPrefix+id))
+	if err == ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// migrate applies a migration and records it, counting the changed keys in
+// result.
+func (tx *Tx) migrate(m Migration, result *MigrationResult) error {
+	tx.changed = make(map[string]struct{})
+	defer func() { tx.changed = nil }()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	result.Changed = len(tx.changed)
+
+	record, err := json.Marshal(appliedMigration{Collection: m.Collection, AppliedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	return tx.set(metaCollection, migrationPrefix+m.ID, string(record), nil)
+}
+
+// validateMigrations checks that every migration has a unique ID and an Up
+// function.
+func validateMigrations(migrations []Migration) error {
+	ids := make(map[string]bool, len(migrations))
+
+	for _, m := range migrations {
+		if m.ID == "" || m.Up == nil {
+			return fmt.Errorf("%w: migration %q needs an ID and an Up function", ErrInvalidConfig, m.ID)
+		}
+
+		if ids[m.ID] {
+			return fmt.Errorf("%w: duplicate migration %q", ErrInvalidConfig, m.ID)
+		}
+		ids[m.ID] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package swmemdb
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// upperMigration upper-cases all values of the users collection.
+var upperMigration = Migration{
+	ID:         "0001-upper",
+	Collection: "users",
+	Up: func(tx *Tx) error {
+		keys, err := tx.Keys("users")
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			value, err := tx.Get("users", key)
+			if err != nil {
+				return err
+			}
+			if err := tx.Set("users", key, strings.ToUpper(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// dropMigration deletes the user bob.
+var dropMigration = Migration{
+	ID:         "0002-drop-bob",
+	Collection: "users",
+	Up: func(tx *Tx) error {
+		return tx.Delete("users", "bob")
+	},
+}
+
+// migrateTestDb returns an in-memory database with three users.
+func migrateTestDb() *DB {
+	db := NewBuntDb(WithMode("memory"))
+	db.SetToCollection("users", "alice", "alice")
+	db.SetToCollection("users", "bob", "bob")
+	db.SetToCollection("users", "root", "ROOT")
+
+	return db
+}
+
+// Test Migrate applies migrations exactly once
+func TestMigrate(t *testing.T) {
+	db := migrateTestDb()
+	defer db.Close()
+
+	results, err := db.Migrate([]Migration{upperMigration, dropMigration})
+	if err != nil {
+		t.Fatalf("Migrate() = %v, want %v", err, "nil")
+	}
+
+	want := []MigrationResult{{ID: "0001-upper", Changed: 2}, {ID: "0002-drop-bob", Changed: 1}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Migrate() = %+v, want %+v", results, want)
+	}
+
+	if value, _ := db.GetFromCollection("users", "alice"); value != "ALICE" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "ALICE")
+	}
+
+	results, err = db.Migrate([]Migration{upperMigration, dropMigration})
+	want = []MigrationResult{{ID: "0001-upper", Skipped: true}, {ID: "0002-drop-bob", Skipped: true}}
+	if err != nil || !reflect.DeepEqual(results, want) {
+		t.Errorf("Migrate() = %+v, %v, want %+v", results, err, want)
+	}
+
+	ids, err := db.AppliedMigrations()
+	if want := []string{"0001-upper", "0002-drop-bob"}; err != nil || !reflect.DeepEqual(ids, want) {
+		t.Errorf("AppliedMigrations() = %v, %v, want %v", ids, err, want)
+	}
+
+	names, _ := db.ListCollections()
+	if want := []string{"users"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListCollections() = %v, want %v", names, want)
+	}
+}
+
+// Test a failing migration is rolled back and not recorded
+func TestMigrateFailure(t *testing.T) {
+	db := migrateTestDb()
+	defer db.Close()
+
+	failing := Migration{ID: "0002-fail", Collection: "users", Up: func(tx *Tx) error {
+		tx.Delete("users", "alice")
+		return errors.New("boom")
+	}}
+
+	results, err := db.Migrate([]Migration{upperMigration, failing, dropMigration})
+	if err == nil || !strings.Contains(err.Error(), "0002-fail") {
+		t.Errorf("Migrate() = %v, want an error naming the migration", err)
+	}
+
+	if len(results) != 1 {
+		t.Errorf("Migrate() = %+v, want 1 result", results)
+	}
+
+	if value, _ := db.GetFromCollection("users", "alice"); value != "ALICE" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "ALICE")
+	}
+
+	if ids, _ := db.AppliedMigrations(); len(ids) != 1 {
+		t.Errorf("AppliedMigrations() = %v, want %v", ids, []string{"0001-upper"})
+	}
+
+	if _, err := db.Migrate([]Migration{upperMigration, upperMigration}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Migrate() = %v, want %v", err, ErrInvalidConfig)
+	}
+}
+
+// Test MigrateDryRun changes nothing
+func TestMigrateDryRun(t *testing.T) {
+	db := migrateTestDb()
+	defer db.Close()
+
+	results, err := db.MigrateDryRun([]Migration{upperMigration, dropMigration})
+	want := []MigrationResult{{ID: "0001-upper", Changed: 2}, {ID: "0002-drop-bob", Changed: 1}}
+	if err != nil || !reflect.DeepEqual(results, want) {
+		t.Errorf("MigrateDryRun() = %+v, %v, want %+v", results, err, want)
+	}
+
+	if value, _ := db.GetFromCollection("users", "alice"); value != "alice" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "alice")
+	}
+
+	if ids, _ := db.AppliedMigrations(); len(ids) != 0 {
+		t.Errorf("AppliedMigrations() = %v, want none", ids)
+	}
+}
+
+// Test WithMigrations applies migrations on startup
+func TestWithMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrate.db")
+
+	db := NewBuntDb(WithMode("file"), WithFile(path))
+	db.SetToCollection("users", "alice", "alice")
+	db.Close()
+
+	db = NewBuntDb(WithMode("file"), WithFile(path), WithMigrations(upperMigration))
+	if value, _ := db.GetFromCollection("users", "alice"); value != "ALICE" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "ALICE")
+	}
+	db.SetToCollection("users", "alice", "changed")
+	db.Close()
+
+	db = NewBuntDb(WithMode("file"), WithFile(path), WithMigrations(upperMigration))
+	defer db.Close()
+
+	if value, _ := db.GetFromCollection("users", "alice"); value != "changed" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "changed")
+	}
+}
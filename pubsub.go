@@ -0,0 +1,326 @@
+package swmemdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// pubsubSeqKey is the key of the sequence number of the last retained
+// message in metaCollection.
+const pubsubSeqKey = "pubsub-seq"
+
+// subscriberBuffer is the default capacity of the channel of a subscriber,
+// not counting replayed messages.
+const subscriberBuffer = 64
+
+// Message is a message published to a channel.
+type Message struct {
+	Channel string
+	Payload string
+	At      time.Time
+}
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Buffer is the capacity of the message channel, not counting replayed
+	// messages. Defaults to 64.
+	Buffer int
+	// Policy decides what happens to messages for a subscriber whose buffer
+	// is full.
+	Policy OverflowPolicy
+}
+
+// retention keeps published messages in a collection.
+type retention struct {
+	collection string
+	d          time.Duration
+}
+
+// retainedMessage is the stored form of a retained message.
+type retainedMessage struct {
+	Channel string    `json:"channel"`
+	Payload string    `json:"payload"`
+	At      time.Time `json:"at"`
+}
+
+// WithMessageRetention keeps published messages in a collection for d, so
+// new subscribers receive the recent messages of their channels first. The
+// messages are stored under their sequence number.
+func WithMessageRetention(collection string, d time.Duration) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.retention = retention{collection: collection, d: d}
+	}
+}
+
+// Publish sends a message to all subscribers of a channel and returns the
+// number of subscribers it was sent to. It blocks until every subscriber
+// with the BlockWriters policy has room for the message, stops subscribing
+// or the database is closed. With message retention
+// the message is stored first; replicas are read-only and fail with
+// ErrReadOnly then.
+func (db *DB) Publish(channel, payload string) (int, error) {
+	msg := Message{Channel: channel, Payload: payload, At: time.Now()}
+
+	var seq uint64
+	if r := db.opts.retention; r.collection != "" && r.d > 0 {
+		err := db.Tx(func(tx *Tx) error {
+			n, err := tx.Incr(metaCollection, pubsubSeqKey, 1)
+			if err != nil {
+				return err
+			}
+			seq = uint64(n)
+
+			value, err := json.Marshal(retainedMessage{Channel: msg.Channel, Payload: msg.Payload, At: msg.At})
+			if err != nil {
+				return err
+			}
+
+			return tx.Set(r.collection, fmt.Sprintf("%016x", seq), string(value), r.d)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return db.bus.publish(msg, seq)
+}
+
+// Subscribe returns a channel receiving the messages published to any
+// channel matching one of the glob patterns, or to any channel if none are
+// given. Patterns are matched like the patterns of buntdb's AscendKeys: '*'
+// matches any sequence of characters and '?' any single character. With
+// message retention the retained messages of the matching channels are
+// received first. The channel is closed when ctx is done or the database is
+// closed. Publishers wait for the subscriber when its buffer is full, see
+// SubscribeWithOptions.
+func (db *DB) Subscribe(ctx context.Context, patterns ...string) (<-chan Message, error) {
+	return db.SubscribeWithOptions(ctx, SubscribeOptions{Policy: BlockWriters}, patterns...)
+}
+
+// SubscribeWithOptions is like Subscribe with a buffer size and a policy
+// for the messages that do not fit into the buffer.
+func (db *DB) SubscribeWithOptions(ctx context.Context, opts SubscribeOptions, patterns ...string) (<-chan Message, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = subscriberBuffer
+	}
+
+	s := &subscriber{patterns: patterns, opts: opts, done: make(chan struct{})}
+
+	if err := db.bus.subscribe(s, db.retained); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			db.bus.unsubscribe(s)
+		case <-s.done:
+		}
+	}()
+
+	return s.ch, nil
+}
+
+// retained returns the retained messages matching any of the patterns in
+// the order they were published, and the sequence number of the last
+// retained message.
+func (db *DB) retained(patterns []string) ([]Message, uint64, error) {
+	r := db.opts.retention
+	if r.collection == "" || r.d <= 0 {
+		return nil, 0, nil
+	}
+
+	var messages []Message
+	var last uint64
+
+	err := db.View(func(tx *Tx) error {
+		value, err := tx.get(metaCollection, pubsubSeqKey)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if last, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return err
+		}
+
+		// expired messages may not have been removed yet
+		since := time.Now().Add(-r.d)
+
+		var decodeErr error
+		err = tx.scan(r.collection, func(key, value string) bool {
+			var m retainedMessage
+			if decodeErr = json.Unmarshal([]byte(value), &m); decodeErr != nil {
+				decodeErr = &DecodeError{Collection: r.collection, Key: key, Err: decodeErr}
+				return false
+			}
+
+			if m.At.After(since) && matchAny(m.Channel, patterns) {
+				messages = append(messages, Message{Channel: m.Channel, Payload: m.Payload, At: m.At})
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		return decodeErr
+	})
+
+	return messages, last, err
+}
+
+// subscriber is a single subscription to the bus.
+type subscriber struct {
+	patterns []string
+	opts     SubscribeOptions
+	ch       chan Message
+	done     chan struct{}
+	stop     sync.Once
+	// after is the sequence number of the last replayed message; retained
+	// messages up to it are not delivered again
+	after uint64
+}
+
+// bus fans out published messages to the subscribers of a database.
+type bus struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+	// done is closed when the bus closes, releasing blocked publishers
+	done     chan struct{}
+	initDone sync.Once
+	stop     sync.Once
+}
+
+// closing returns a channel that is closed when the bus closes.
+func (b *bus) closing() chan struct{} {
+	b.initDone.Do(func() { b.done = make(chan struct{}) })
+	return b.done
+}
+
+// subscribe adds a subscriber to the bus after queueing the messages
+// returned by replay for it. Messages published while replay runs are
+// delivered after them.
+func (b *bus) subscribe(s *subscriber, replay func(patterns []string) ([]Message, uint64, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return bunt.ErrDatabaseClosed
+	}
+
+	messages, last, err := replay(s.patterns)
+	if err != nil {
+		return err
+	}
+
+	s.ch = make(chan Message, s.opts.Buffer+len(messages))
+	for _, msg := range messages {
+		s.ch <- msg
+	}
+	s.after = last
+
+	if b.subscribers == nil {
+		b.subscribers = map[*subscriber]struct{}{}
+	}
+	b.subscribers[s] = struct{}{}
+
+	return nil
+}
+
+// unsubscribe removes a subscriber from the bus and closes its channel.
+func (b *bus) unsubscribe(s *subscriber) {
+	// release publishers blocked on the subscriber before taking the lock
+	s.stop.Do(func() { close(s.done) })
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// publish delivers a message with the given sequence number, zero if it is
+// not retained, to all interested subscribers.
+func (b *bus) publish(msg Message, seq uint64) (int, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return 0, bunt.ErrDatabaseClosed
+	}
+
+	var n int
+	for s := range b.subscribers {
+		if seq != 0 && seq <= s.after {
+			// replayed
+			continue
+		}
+
+		if !matchAny(msg.Channel, s.patterns) {
+			continue
+		}
+
+		if s.opts.Policy != BlockWriters {
+			select {
+			case s.ch <- msg:
+				n++
+			default:
+			}
+			continue
+		}
+
+		select {
+		case s.ch <- msg:
+			n++
+		case <-s.done:
+		case <-b.closing():
+			return n, bunt.ErrDatabaseClosed
+		}
+	}
+
+	return n, nil
+}
+
+// close unsubscribes all subscribers and refuses new ones.
+func (b *bus) close() {
+	// release publishers blocked on subscribers before taking the lock
+	b.stop.Do(func() { close(b.closing()) })
+
+	b.mu.Lock()
+	b.closed = true
+	subscribers := make([]*subscriber, 0, len(b.subscribers))
+	for s := range b.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subscribers {
+		b.unsubscribe(s)
+	}
+}
+
+// matchAny reports whether channel matches any of the patterns.
+func matchAny(channel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if bunt.Match(channel, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+package swmemdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// receive receives a message or fails the test.
+func receive(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+// Test Publish and Subscribe
+func TestPubSub(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	orders, err := db.Subscribe(ctx, "orders.*")
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	all, _ := db.Subscribe(ctx)
+
+	if n, err := db.Publish("orders.created", "1"); err != nil || n != 2 {
+		t.Errorf("Publish() = %v, %v, want %v", n, err, 2)
+	}
+
+	if n, _ := db.Publish("users.created", "alice"); n != 1 {
+		t.Errorf("Publish() = %v, want %v", n, 1)
+	}
+
+	if msg := receive(t, orders); msg.Channel != "orders.created" || msg.Payload != "1" {
+		t.Errorf("Subscribe() received %+v, want %v on %v", msg, "1", "orders.created")
+	}
+
+	for _, want := range []string{"1", "alice"} {
+		if msg := receive(t, all); msg.Payload != want {
+			t.Errorf("Subscribe() received %v, want %v", msg.Payload, want)
+		}
+	}
+
+	select {
+	case msg := <-orders:
+		t.Errorf("Subscribe() received %+v, want nothing", msg)
+	default:
+	}
+
+	// nothing is stored without retention
+	if names, _ := db.ListCollections(); len(names) != 0 {
+		t.Errorf("ListCollections() = %v, want none", names)
+	}
+}
+
+// Test the channel is closed when the context is done or the database is
+// closed
+func TestPubSubClose(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, _ := db.Subscribe(ctx, "*")
+	cancel()
+
+	if _, ok := <-ch; ok {
+		t.Errorf("Subscribe() channel open after cancel")
+	}
+
+	if n, _ := db.Publish("a", "1"); n != 0 {
+		t.Errorf("Publish() = %v, want %v", n, 0)
+	}
+
+	ch, _ = db.Subscribe(context.Background(), "*")
+	db.Close()
+
+	if _, ok := <-ch; ok {
+		t.Errorf("Subscribe() channel open after Close")
+	}
+}
+
+// Test Close releases publishers blocked on a subscriber that does not read
+func TestPubSubCloseBlocked(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+
+	db.Subscribe(context.Background(), "*")
+
+	published := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			_, err = db.Publish("a", "1")
+		}
+		published <- err
+	}()
+
+	// wait for the publisher to fill the buffer
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- db.Close() }()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() = %v, want %v", err, "nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Close() blocked by a publisher")
+	}
+
+	if err := <-published; err != bunt.ErrDatabaseClosed {
+		t.Errorf("Publish() = %v, want %v", err, bunt.ErrDatabaseClosed)
+	}
+}
+
+// Test messages for slow subscribers are dropped with DropEvents
+func TestPubSubDrop(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	ch, err := db.SubscribeWithOptions(context.Background(), SubscribeOptions{Buffer: 1, Policy: DropEvents}, "*")
+	if err != nil {
+		t.Fatalf("SubscribeWithOptions() = %v, want %v", err, "nil")
+	}
+
+	for i, want := range []int{1, 0, 0} {
+		if n, err := db.Publish("a", strconv.Itoa(i)); err != nil || n != want {
+			t.Errorf("Publish() = %v, %v, want %v", n, err, want)
+		}
+	}
+
+	if msg := <-ch; msg.Payload != "0" {
+		t.Errorf("Subscribe() received %v, want %v", msg.Payload, "0")
+	}
+}
+
+// Test late subscribers receive retained messages
+func TestPubSubRetention(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithMessageRetention("messages", 100*time.Millisecond))
+	defer db.Close()
+
+	db.Publish("orders.created", "1")
+	time.Sleep(150 * time.Millisecond)
+	db.Publish("orders.created", "2")
+	db.Publish("users.created", "alice")
+	db.Publish("orders.paid", "2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := db.Subscribe(ctx, "orders.*")
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	db.Publish("orders.shipped", "2")
+
+	for _, want := range []string{"orders.created", "orders.paid", "orders.shipped"} {
+		if msg := receive(t, ch); msg.Channel != want {
+			t.Errorf("Subscribe() received %v, want %v", msg.Channel, want)
+		}
+	}
+
+	if keys, _ := db.GetKeysFromCollection("messages"); len(keys) < 4 {
+		t.Errorf("GetKeysFromCollection() = %v, want at least 4 keys", keys)
+	}
+}
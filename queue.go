@@ -0,0 +1,447 @@
+package swmemdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefixes of the keys queues keep in metaCollection: the sequence number of
+// the jobs of a queue, and empty keys marking its jobs as ready or delayed.
+// Ready keys order the visible jobs like their IDs, delayed keys order the
+// invisible jobs by the time they become visible.
+const (
+	queueSeqPrefix     = "queue-seq:"
+	queueReadyPrefix   = "queue-ready:"
+	queueDelayedPrefix = "queue-delayed:"
+)
+
+// Queue is a durable job queue stored in a collection. Jobs are dequeued in
+// order of priority, then in the order they were enqueued. A dequeued job
+// stays in the queue, invisible to others, until it is acknowledged or its
+// visibility timeout expires; jobs in flight when the process stops are
+// therefore delivered again once their timeout has expired.
+//
+// Besides its collection, a queue keeps ordered keys marking its jobs as
+// ready or delayed in a reserved collection, so taking a job only reads the
+// first ready one.
+type Queue struct {
+	db         *DB
+	collection string
+	opts       QueueOptions
+}
+
+// QueueOptions configures a Queue.
+type QueueOptions struct {
+	// MaxAttempts is the number of times a job is delivered before it is
+	// moved to the dead-letter collection. Zero retries jobs forever.
+	MaxAttempts int
+	// DeadLetter is the collection jobs are moved to after MaxAttempts
+	// deliveries. Defaults to the collection of the queue followed by
+	// "_dead".
+	DeadLetter string
+}
+
+// EnqueueOptions configures an enqueued job.
+type EnqueueOptions struct {
+	// Delay is the time before the job can be dequeued.
+	Delay time.Duration
+	// Priority orders the jobs, higher priorities are dequeued first.
+	Priority int
+}
+
+// Job is a job dequeued from a Queue.
+type Job struct {
+	// ID identifies the job within its queue.
+	ID string
+	// Payload is the payload the job was enqueued with.
+	Payload string
+	// Priority is the priority the job was enqueued with.
+	Priority int
+	// Attempts is the number of times the job has been delivered, including
+	// this delivery.
+	Attempts int
+	// EnqueuedAt is the time the job was enqueued.
+	EnqueuedAt time.Time
+}
+
+// jobRecord is the stored form of a job.
+type jobRecord struct {
+	Payload    string    `json:"payload"`
+	Priority   int       `json:"priority"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	VisibleAt  time.Time `json:"visible_at"`
+}
+
+// NewQueue returns the queue stored in a collection.
+func NewQueue(db *DB, collection string, opts QueueOptions) *Queue {
+	if opts.DeadLetter == "" {
+		opts.DeadLetter = collection + "_dead"
+	}
+
+	return &Queue{db: db, collection: collection, opts: opts}
+}
+
+// Enqueue adds a job with the given payload to the queue and returns its ID.
+func (q *Queue) Enqueue(payload string, opts EnqueueOptions) (string, error) {
+	var id string
+
+	err := q.db.Tx(func(tx *Tx) error {
+		seq, err := tx.Incr(metaCollection, queueSeqPrefix+q.collection, 1)
+		if err != nil {
+			return err
+		}
+
+		// keys order the jobs by descending priority, then by sequence
+		id = fmt.Sprintf("%016x%016x", ^(uint64(opts.Priority) ^ 1<<63), uint64(seq))
+
+		now := time.Now()
+		record := jobRecord{
+			Payload:    payload,
+			Priority:   opts.Priority,
+			EnqueuedAt: now,
+			VisibleAt:  now.Add(opts.Delay),
+		}
+		if err := q.store(tx, id, record); err != nil {
+			return err
+		}
+
+		return q.schedule(tx, id, record, now)
+	})
+
+	return id, err
+}
+
+// Dequeue takes the next job from the queue, waiting until one is available
+// or ctx is done. The job stays invisible for visibilityTimeout; unless it
+// is acknowledged before, it is delivered again.
+func (q *Queue) Dequeue(ctx context.Context, visibilityTimeout time.Duration) (Job, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// wake up when jobs become ready, not when others take jobs
+	events, err := q.db.Watch(ctx, metaCollection, WatchOptions{Types: []EventType{EventSet}})
+	if err != nil {
+		return Job{}, err
+	}
+	ready := q.readyPrefix()
+
+	for {
+		job, next, err := q.dequeue(visibilityTimeout)
+		if err != ErrNotFound {
+			return job, err
+		}
+
+		wait := time.Second
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+
+		timer := time.NewTimer(wait)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return Job{}, ctx.Err()
+			case ev := <-events:
+				if strings.HasPrefix(ev.Key, ready) {
+					break wait
+				}
+			case <-timer.C:
+				break wait
+			}
+		}
+		timer.Stop()
+	}
+}
+
+// Ack acknowledges a job, removing it from the queue. Fails with ErrJobLost
+// if the job was delivered again in the meantime.
+func (q *Queue) Ack(job Job) error {
+	return q.db.Tx(func(tx *Tx) error {
+		record, err := q.inFlight(tx, job)
+		if err != nil {
+			return err
+		}
+
+		if err := q.unschedule(tx, job.ID, record); err != nil {
+			return err
+		}
+
+		return tx.Delete(q.collection, job.ID)
+	})
+}
+
+// Nack releases a job to be delivered again after delay, or moves it to the
+// dead-letter collection if it has been delivered MaxAttempts times. Fails
+// with ErrJobLost if the job was delivered again in the meantime.
+func (q *Queue) Nack(job Job, delay time.Duration) error {
+	return q.db.Tx(func(tx *Tx) error {
+		record, err := q.inFlight(tx, job)
+		if err != nil {
+			return err
+		}
+
+		if q.exhausted(record) {
+			return q.deadLetter(tx, job.ID, record)
+		}
+
+		if err := q.unschedule(tx, job.ID, record); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		record.VisibleAt = now.Add(delay)
+		if err := q.store(tx, job.ID, record); err != nil {
+			return err
+		}
+
+		return q.schedule(tx, job.ID, record, now)
+	})
+}
+
+// Len returns the number of jobs in the queue, including delayed jobs and
+// jobs in flight.
+func (q *Queue) Len() (int, error) {
+	keys, err := q.db.GetKeysFromCollection(q.collection)
+	return len(keys), err
+}
+
+// dequeue takes the next visible job from the queue. If there is none, it
+// fails with ErrNotFound and returns the time the next job becomes visible,
+// if any. Visible jobs that were delivered MaxAttempts times are moved to
+// the dead-letter collection.
+func (q *Queue) dequeue(visibilityTimeout time.Duration) (job Job, next time.Time, err error) {
+	err = q.db.Tx(func(tx *Tx) error {
+		now := time.Now()
+
+		var err error
+		if next, err = q.promote(tx, now); err != nil {
+			return err
+		}
+
+		for {
+			id, err := q.firstReady(tx)
+			if err != nil || id == "" {
+				return err
+			}
+
+			value, err := tx.get(q.collection, id)
+			if err == ErrNotFound {
+				// the job is gone, forget it
+				if err := tx.Delete(metaCollection, q.readyKey(id)); err != nil {
+					return err
+				}
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			var record jobRecord
+			if err := json.Unmarshal([]byte(value), &record); err != nil {
+				return &DecodeError{Collection: q.collection, Key: id, Err: err}
+			}
+
+			if q.exhausted(record) {
+				if err := q.deadLetter(tx, id, record); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := q.unschedule(tx, id, record); err != nil {
+				return err
+			}
+
+			record.Attempts++
+			record.VisibleAt = now.Add(visibilityTimeout)
+			job = Job{
+				ID:         id,
+				Payload:    record.Payload,
+				Priority:   record.Priority,
+				Attempts:   record.Attempts,
+				EnqueuedAt: record.EnqueuedAt,
+			}
+
+			if err := q.store(tx, id, record); err != nil {
+				return err
+			}
+
+			return q.schedule(tx, id, record, now)
+		}
+	})
+	if err == nil && job.ID == "" {
+		err = ErrNotFound
+	}
+
+	return job, next, err
+}
+
+// promote marks the delayed jobs that are visible at now as ready and
+// returns the time the next delayed job becomes visible, if any.
+func (q *Queue) promote(tx *Tx, now time.Time) (next time.Time, err error) {
+	prefix := collectionKey(metaCollection, q.delayedPrefix())
+
+	var ids []string
+	var parseErr error
+	iterErr := tx.tx.AscendGreaterOrEqual("", prefix, func(key, _ string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+
+		key = key[len(prefix):]
+		if len(key) < 16 {
+			parseErr = fmt.Errorf("invalid delayed job key %q", key)
+			return false
+		}
+
+		nanos, err := strconv.ParseUint(key[:16], 16, 64)
+		if err != nil {
+			parseErr = fmt.Errorf("invalid delayed job key %q: %w", key, err)
+			return false
+		}
+
+		if visibleAt := time.Unix(0, int64(nanos)); visibleAt.After(now) {
+			next = visibleAt
+			return false
+		}
+
+		ids = append(ids, key)
+		return true
+	})
+	if iterErr != nil {
+		return next, iterErr
+	}
+	if parseErr != nil {
+		return next, parseErr
+	}
+
+	for _, key := range ids {
+		if err := tx.Delete(metaCollection, q.delayedPrefix()+key); err != nil {
+			return next, err
+		}
+
+		if err := tx.Set(metaCollection, q.readyKey(key[16:]), ""); err != nil {
+			return next, err
+		}
+	}
+
+	return next, nil
+}
+
+// firstReady returns the ID of the first ready job, or an empty ID if no job
+// is ready.
+func (q *Queue) firstReady(tx *Tx) (string, error) {
+	prefix := collectionKey(metaCollection, q.readyPrefix())
+
+	var id string
+	err := tx.tx.AscendGreaterOrEqual("", prefix, func(key, _ string) bool {
+		if strings.HasPrefix(key, prefix) {
+			id = key[len(prefix):]
+		}
+		return false
+	})
+
+	return id, err
+}
+
+// schedule marks a job as ready if it is visible at now, or as delayed.
+func (q *Queue) schedule(tx *Tx, id string, record jobRecord, now time.Time) error {
+	if record.VisibleAt.After(now) {
+		return tx.Set(metaCollection, q.delayedKey(id, record.VisibleAt), "")
+	}
+
+	return tx.Set(metaCollection, q.readyKey(id), "")
+}
+
+// unschedule removes the ready or delayed mark of a job.
+func (q *Queue) unschedule(tx *Tx, id string, record jobRecord) error {
+	for _, key := range []string{q.readyKey(id), q.delayedKey(id, record.VisibleAt)} {
+		if err := tx.Delete(metaCollection, key); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readyPrefix returns the prefix of the ready keys of the queue.
+func (q *Queue) readyPrefix() string {
+	return queueReadyPrefix + q.collection + ":"
+}
+
+// delayedPrefix returns the prefix of the delayed keys of the queue.
+func (q *Queue) delayedPrefix() string {
+	return queueDelayedPrefix + q.collection + ":"
+}
+
+// readyKey returns the key marking a job as ready.
+func (q *Queue) readyKey(id string) string {
+	return q.readyPrefix() + id
+}
+
+// delayedKey returns the key marking a job as delayed until visibleAt.
+func (q *Queue) delayedKey(id string, visibleAt time.Time) string {
+	return fmt.Sprintf("%s%016x%s", q.delayedPrefix(), uint64(visibleAt.UnixNano()), id)
+}
+
+// inFlight returns the record of a dequeued job, failing with ErrJobLost
+// if it was delivered again or removed since.
+func (q *Queue) inFlight(tx *Tx, job Job) (jobRecord, error) {
+	var record jobRecord
+
+	value, err := tx.get(q.collection, job.ID)
+	if err == ErrNotFound {
+		return record, fmt.Errorf("%w: %s", ErrJobLost, job.ID)
+	} else if err != nil {
+		return record, err
+	}
+
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return record, &DecodeError{Collection: q.collection, Key: job.ID, Err: err}
+	}
+
+	if record.Attempts != job.Attempts {
+		return record, fmt.Errorf("%w: %s", ErrJobLost, job.ID)
+	}
+
+	return record, nil
+}
+
+// exhausted reports whether a job has been delivered MaxAttempts times.
+func (q *Queue) exhausted(record jobRecord) bool {
+	return q.opts.MaxAttempts > 0 && record.Attempts >= q.opts.MaxAttempts
+}
+
+// deadLetter moves a job to the dead-letter collection.
+func (q *Queue) deadLetter(tx *Tx, id string, record jobRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Set(q.opts.DeadLetter, id, string(value)); err != nil {
+		return err
+	}
+
+	if err := q.unschedule(tx, id, record); err != nil {
+		return err
+	}
+
+	return tx.Delete(q.collection, id)
+}
+
+// store stores a job.
+func (q *Queue) store(tx *Tx, id string, record jobRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(q.collection, id, string(value))
+}
@@ -0,0 +1,176 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dequeue dequeues a job without waiting.
+func dequeue(t *testing.T, q *Queue, visibilityTimeout time.Duration) (Job, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	return q.Dequeue(ctx, visibilityTimeout)
+}
+
+// Test jobs are dequeued by priority, then in order
+func TestQueue(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	q := NewQueue(db, "jobs", QueueOptions{})
+	q.Enqueue("a", EnqueueOptions{})
+	q.Enqueue("b", EnqueueOptions{})
+	q.Enqueue("urgent", EnqueueOptions{Priority: 10})
+	q.Enqueue("later", EnqueueOptions{Priority: 100, Delay: time.Hour})
+	q.Enqueue("low", EnqueueOptions{Priority: -1})
+
+	for _, want := range []string{"urgent", "a", "b", "low"} {
+		job, err := dequeue(t, q, time.Minute)
+		if err != nil || job.Payload != want {
+			t.Fatalf("Dequeue() = %v, %v, want %v", job.Payload, err, want)
+		}
+
+		if err := q.Ack(job); err != nil {
+			t.Errorf("Ack() = %v", err)
+		}
+	}
+
+	if _, err := dequeue(t, q, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("Dequeue() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if n, _ := q.Len(); n != 1 {
+		t.Errorf("Len() = %v, want %v", n, 1)
+	}
+}
+
+// Test Dequeue waits for jobs to be enqueued
+func TestQueueWait(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	q := NewQueue(db, "jobs", QueueOptions{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q.Enqueue("a", EnqueueOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if job, err := q.Dequeue(ctx, time.Minute); err != nil || job.Payload != "a" {
+		t.Errorf("Dequeue() = %v, %v, want %v", job.Payload, err, "a")
+	}
+}
+
+// Test jobs are delivered again after their visibility timeout or a Nack,
+// and moved to the dead-letter collection after MaxAttempts
+func TestQueueRetry(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	q := NewQueue(db, "jobs", QueueOptions{MaxAttempts: 3})
+	id, _ := q.Enqueue("a", EnqueueOptions{})
+
+	first, _ := dequeue(t, q, 50*time.Millisecond)
+	if _, err := dequeue(t, q, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("Dequeue() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	second, err := dequeue(t, q, time.Minute)
+	if err != nil || second.ID != id || second.Attempts != 2 {
+		t.Fatalf("Dequeue() = %+v, %v, want attempt %v of %v", second, err, 2, id)
+	}
+
+	if err := q.Ack(first); !errors.Is(err, ErrJobLost) {
+		t.Errorf("Ack() = %v, want %v", err, ErrJobLost)
+	}
+
+	if err := q.Nack(second, 0); err != nil {
+		t.Errorf("Nack() = %v", err)
+	}
+
+	third, _ := dequeue(t, q, time.Minute)
+	if third.Attempts != 3 {
+		t.Errorf("Dequeue().Attempts = %v, want %v", third.Attempts, 3)
+	}
+
+	if err := q.Nack(third, 0); err != nil {
+		t.Errorf("Nack() = %v", err)
+	}
+
+	if n, _ := q.Len(); n != 0 {
+		t.Errorf("Len() = %v, want %v", n, 0)
+	}
+
+	if keys, _ := db.GetKeysFromCollection("jobs_dead"); len(keys) != 1 || keys[0] != id {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, []string{id})
+	}
+}
+
+// Test jobs in flight are delivered again after a restart
+func TestQueueRecovery(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.db")
+
+	db := NewBuntDb(WithMode("file"), WithFile(file))
+	q := NewQueue(db, "jobs", QueueOptions{})
+	q.Enqueue("a", EnqueueOptions{})
+	q.Enqueue("b", EnqueueOptions{})
+	dequeue(t, q, 50*time.Millisecond)
+	db.Close()
+
+	db = NewBuntDb(WithMode("file"), WithFile(file))
+	defer db.Close()
+	q = NewQueue(db, "jobs", QueueOptions{})
+
+	if job, _ := dequeue(t, q, time.Minute); job.Payload != "b" {
+		t.Errorf("Dequeue() = %v, want %v", job.Payload, "b")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if job, _ := dequeue(t, q, time.Minute); job.Payload != "a" || job.Attempts != 2 {
+		t.Errorf("Dequeue() = %+v, want attempt %v of %v", job, 2, "a")
+	}
+
+	// new jobs are enqueued after the recovered ones
+	q.Enqueue("c", EnqueueOptions{})
+	if job, _ := dequeue(t, q, time.Minute); job.Payload != "c" {
+		t.Errorf("Dequeue() = %v, want %v", job.Payload, "c")
+	}
+}
+
+// Test delayed jobs are dequeued by priority once visible, and acknowledged
+// jobs leave no marks behind
+func TestQueueDelayed(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	q := NewQueue(db, "jobs", QueueOptions{})
+	q.Enqueue("a", EnqueueOptions{Delay: 30 * time.Millisecond})
+	q.Enqueue("b", EnqueueOptions{Delay: 10 * time.Millisecond, Priority: 1})
+	q.Enqueue("c", EnqueueOptions{})
+
+	time.Sleep(50 * time.Millisecond)
+	for _, want := range []string{"b", "a", "c"} {
+		job, err := dequeue(t, q, time.Minute)
+		if err != nil || job.Payload != want {
+			t.Fatalf("Dequeue() = %v, %v, want %v", job.Payload, err, want)
+		}
+
+		if err := q.Ack(job); err != nil {
+			t.Errorf("Ack() = %v", err)
+		}
+	}
+
+	keys, err := db.GetKeysFromCollection(metaCollection)
+	if want := []string{queueSeqPrefix + "jobs"}; err != nil || len(keys) != 1 || keys[0] != want[0] {
+		t.Errorf("GetKeysFromCollection() = %v, %v, want %v", keys, err, want)
+	}
+}
@@ -0,0 +1,196 @@
+package swmemdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateAlgorithm is the algorithm a RateLimiter limits requests with.
+type RateAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to limit requests and refills the
+	// bucket at limit requests per window.
+	TokenBucket RateAlgorithm = iota
+	// FixedWindow allows limit requests per window, the windows starting at
+	// multiples of the window duration.
+	FixedWindow
+	// SlidingLog allows limit requests within any window ending now. It
+	// stores the time of every allowed request.
+	SlidingLog
+)
+
+// RateLimiter limits the rate of requests per key. Its state is stored in a
+// collection, one key per limited key, so it is shared by everyone using the
+// same collection of a database.
+type RateLimiter struct {
+	db         *DB
+	collection string
+	algorithm  RateAlgorithm
+	limit      int
+	window     time.Duration
+	now        func() time.Time
+}
+
+// tokenBucketState is the stored state of a key limited by TokenBucket.
+type tokenBucketState struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// fixedWindowState is the stored state of a key limited by FixedWindow.
+type fixedWindowState struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// slidingLogState is the stored state of a key limited by SlidingLog.
+type slidingLogState struct {
+	Requests []time.Time `json:"requests"`
+}
+
+// NewRateLimiter returns a rate limiter allowing limit requests per window
+// for every key, storing its state in the given collection.
+func NewRateLimiter(db *DB, collection string, algorithm RateAlgorithm, limit int, window time.Duration) (*RateLimiter, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, fmt.Errorf("%w: rate limit and window must be positive", ErrInvalidConfig)
+	}
+
+	if algorithm < TokenBucket || algorithm > SlidingLog {
+		return nil, fmt.Errorf("%w: unknown rate algorithm %d", ErrInvalidConfig, algorithm)
+	}
+
+	return &RateLimiter{
+		db:         db,
+		collection: collection,
+		algorithm:  algorithm,
+		limit:      limit,
+		window:     window,
+		now:        time.Now,
+	}, nil
+}
+
+// Allow records a request for key if it is within the limit. It returns
+// whether the request is allowed, how many more requests are allowed right
+// now and, if the request is not allowed, how long to wait before retrying.
+// The check and the update are made in a single transaction.
+func (l *RateLimiter) Allow(key string) (allowed bool, remaining int, retryAfter time.Duration, err error) {
+	err = l.db.Tx(func(tx *Tx) error {
+		value, err := tx.get(l.collection, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		exists := err == nil
+
+		now := l.now()
+		switch l.algorithm {
+		case TokenBucket:
+			allowed, remaining, retryAfter, err = l.tokenBucket(tx, key, value, exists, now)
+		case FixedWindow:
+			allowed, remaining, retryAfter, err = l.fixedWindow(tx, key, value, exists, now)
+		default:
+			allowed, remaining, retryAfter, err = l.slidingLog(tx, key, value, exists, now)
+		}
+
+		return err
+	})
+
+	return allowed, remaining, retryAfter, err
+}
+
+// tokenBucket applies TokenBucket to a request at now.
+func (l *RateLimiter) tokenBucket(tx *Tx, key, value string, exists bool, now time.Time) (bool, int, time.Duration, error) {
+	state := tokenBucketState{Tokens: float64(l.limit), Updated: now}
+	if exists {
+		if err := l.unmarshal(key, value, &state); err != nil {
+			return false, 0, 0, err
+		}
+	}
+
+	// refill the tokens since the last update
+	rate := float64(l.limit) / float64(l.window)
+	if elapsed := now.Sub(state.Updated); elapsed > 0 {
+		state.Tokens = math.Min(float64(l.limit), state.Tokens+float64(elapsed)*rate)
+	}
+	state.Updated = now
+
+	if state.Tokens < 1 {
+		return false, 0, time.Duration(math.Ceil((1 - state.Tokens) / rate)), nil
+	}
+	state.Tokens--
+
+	// a bucket is full again after a window, so its state can expire
+	return true, int(state.Tokens), 0, l.store(tx, key, state, l.window)
+}
+
+// fixedWindow applies FixedWindow to a request at now.
+func (l *RateLimiter) fixedWindow(tx *Tx, key, value string, exists bool, now time.Time) (bool, int, time.Duration, error) {
+	state := fixedWindowState{Start: now.Truncate(l.window)}
+	if exists {
+		var stored fixedWindowState
+		if err := l.unmarshal(key, value, &stored); err != nil {
+			return false, 0, 0, err
+		}
+
+		if stored.Start.Equal(state.Start) {
+			state = stored
+		}
+	}
+
+	end := state.Start.Add(l.window)
+	if state.Count >= l.limit {
+		return false, 0, end.Sub(now), nil
+	}
+	state.Count++
+
+	return true, l.limit - state.Count, 0, l.store(tx, key, state, end.Sub(now))
+}
+
+// slidingLog applies SlidingLog to a request at now.
+func (l *RateLimiter) slidingLog(tx *Tx, key, value string, exists bool, now time.Time) (bool, int, time.Duration, error) {
+	var state slidingLogState
+	if exists {
+		if err := l.unmarshal(key, value, &state); err != nil {
+			return false, 0, 0, err
+		}
+	}
+
+	// forget the requests that left the window
+	start := now.Add(-l.window)
+	i := 0
+	for i < len(state.Requests) && !state.Requests[i].After(start) {
+		i++
+	}
+	state.Requests = state.Requests[i:]
+
+	if len(state.Requests) >= l.limit {
+		// retry once the oldest request that keeps it over the limit leaves
+		// the window
+		oldest := state.Requests[len(state.Requests)-l.limit]
+		return false, 0, oldest.Add(l.window).Sub(now), nil
+	}
+	state.Requests = append(state.Requests, now)
+
+	return true, l.limit - len(state.Requests), 0, l.store(tx, key, state, l.window)
+}
+
+// unmarshal decodes the stored state of a key.
+func (l *RateLimiter) unmarshal(key, value string, state interface{}) error {
+	if err := json.Unmarshal([]byte(value), state); err != nil {
+		return &DecodeError{Collection: l.collection, Key: key, Err: err}
+	}
+
+	return nil
+}
+
+// store stores the state of a key, expiring after exp.
+func (l *RateLimiter) store(tx *Tx, key string, state interface{}, exp time.Duration) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return tx.set(l.collection, key, string(value), expiryOptions(exp))
+}
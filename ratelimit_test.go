@@ -0,0 +1,169 @@
+package swmemdb
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter returns a rate limiter whose clock is set through the
+// returned pointer.
+func newTestRateLimiter(t *testing.T, db *DB, algorithm RateAlgorithm, limit int, window time.Duration) (*RateLimiter, *time.Time) {
+	l, err := NewRateLimiter(db, "limits", algorithm, limit, window)
+	if err != nil {
+		t.Fatalf("NewRateLimiter() = %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	return l, &now
+}
+
+// rateResult is the result of RateLimiter.Allow.
+type rateResult struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+// allow calls Allow and fails the test on errors.
+func allow(t *testing.T, l *RateLimiter, key string) rateResult {
+	allowed, remaining, retryAfter, err := l.Allow(key)
+	if err != nil {
+		t.Fatalf("Allow() = %v", err)
+	}
+
+	return rateResult{allowed, remaining, retryAfter}
+}
+
+// Test TokenBucket
+func TestRateLimiterTokenBucket(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	l, now := newTestRateLimiter(t, db, TokenBucket, 2, time.Second)
+
+	tests := []struct {
+		advance time.Duration
+		want    rateResult
+	}{
+		{0, rateResult{true, 1, 0}},
+		{0, rateResult{true, 0, 0}},
+		{0, rateResult{false, 0, 500 * time.Millisecond}},
+		{250 * time.Millisecond, rateResult{false, 0, 250 * time.Millisecond}},
+		{250 * time.Millisecond, rateResult{true, 0, 0}},
+		{10 * time.Second, rateResult{true, 1, 0}},
+	}
+	for i, tt := range tests {
+		*now = now.Add(tt.advance)
+		if got := allow(t, l, "alice"); got != tt.want {
+			t.Errorf("%d: Allow() = %+v, want %+v", i, got, tt.want)
+		}
+	}
+
+	// keys are limited separately
+	if got := allow(t, l, "bob"); !got.allowed {
+		t.Errorf("Allow() = %+v, want allowed", got)
+	}
+
+	keys, _ := db.GetKeysFromCollection("limits")
+	if len(keys) != 2 {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, []string{"alice", "bob"})
+	}
+}
+
+// Test FixedWindow
+func TestRateLimiterFixedWindow(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	l, now := newTestRateLimiter(t, db, FixedWindow, 2, time.Minute)
+	*now = now.Add(20 * time.Second)
+
+	tests := []struct {
+		advance time.Duration
+		want    rateResult
+	}{
+		{0, rateResult{true, 1, 0}},
+		{0, rateResult{true, 0, 0}},
+		{10 * time.Second, rateResult{false, 0, 30 * time.Second}},
+		{30 * time.Second, rateResult{true, 1, 0}},
+	}
+	for i, tt := range tests {
+		*now = now.Add(tt.advance)
+		if got := allow(t, l, "alice"); got != tt.want {
+			t.Errorf("%d: Allow() = %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
+
+// Test SlidingLog
+func TestRateLimiterSlidingLog(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	l, now := newTestRateLimiter(t, db, SlidingLog, 2, time.Minute)
+
+	tests := []struct {
+		advance time.Duration
+		want    rateResult
+	}{
+		{0, rateResult{true, 1, 0}},
+		{40 * time.Second, rateResult{true, 0, 0}},
+		{10 * time.Second, rateResult{false, 0, 10 * time.Second}},
+		{10 * time.Second, rateResult{true, 0, 0}},
+		{10 * time.Second, rateResult{false, 0, 30 * time.Second}},
+	}
+	for i, tt := range tests {
+		*now = now.Add(tt.advance)
+		if got := allow(t, l, "alice"); got != tt.want {
+			t.Errorf("%d: Allow() = %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
+
+// Test NewRateLimiter rejects invalid limits and Allow corrupt state
+func TestRateLimiterErrors(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	if _, err := NewRateLimiter(db, "limits", TokenBucket, 0, time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("NewRateLimiter() = %v, want %v", err, ErrInvalidConfig)
+	}
+
+	l, _ := NewRateLimiter(db, "limits", FixedWindow, 1, time.Second)
+	db.SetToCollection("limits", "alice", "garbage")
+
+	var decodeErr *DecodeError
+	if _, _, _, err := l.Allow("alice"); !errors.As(err, &decodeErr) {
+		t.Errorf("Allow() = %v, want a *DecodeError", err)
+	}
+}
+
+// Test concurrent requests never exceed the limit
+func TestRateLimiterConcurrent(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	l, _ := NewRateLimiter(db, "limits", SlidingLog, 10, time.Hour)
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _, _, _ := l.Allow("alice"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 10 {
+		t.Errorf("Allow() allowed %v requests, want %v", n, 10)
+	}
+}
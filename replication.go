@@ -0,0 +1,426 @@
+package swmemdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+const (
+	// replicationBacklog is the number of mutations kept for replicas that
+	// reconnect. Replicas that fall further behind resync from a snapshot.
+	replicationBacklog = 10000
+	// replicationBuffer is the number of committed transactions buffered per
+	// replica. Replicas that cannot keep up are disconnected.
+	replicationBuffer = 1024
+	// replicaDialTimeout limits connecting to the primary.
+	replicaDialTimeout = 5 * time.Second
+)
+
+// replicaRetryDelay is the time a replica waits before reconnecting.
+var replicaRetryDelay = time.Second
+
+// mutation is a single committed change sent to replicas. Values are sent in
+// their stored form, so replicas must use the same encryption key.
+type mutation struct {
+	Seq   uint64
+	Type  EventType
+	Key   string
+	Value string
+	TTL   time.Duration
+}
+
+// replicaHello is sent by a replica when it connects, naming the primary
+// run and the last mutation it has applied.
+type replicaHello struct {
+	ID  string
+	Seq uint64
+}
+
+// replicationMessage is sent by the primary. The first message of a
+// connection names the primary run and either holds a full snapshot taken at
+// Seq or the mutations the replica has missed.
+type replicationMessage struct {
+	ID        string
+	Seq       uint64
+	Full      bool
+	Snapshot  []byte
+	Mutations []mutation
+}
+
+// WithReplicaOf opens the database as a read-only replica of the primary
+// serving replication at addr, see ServeReplication. Writes fail with
+// ErrReadOnly; the replica follows the primary in the background and
+// reconnects when the connection is lost.
+func WithReplicaOf(addr string) BuntDbOptionsFn {
+	return func(o *buntDbOptions) {
+		o.replicaOf = addr
+	}
+}
+
+// ServeReplication accepts replica connections on ln and streams every
+// committed mutation of db to them until ln is closed. Replicas that
+// connect for the first time, or have fallen too far behind, first receive
+// a full snapshot.
+func ServeReplication(ln net.Listener, db *DB) error {
+	db.repl.enable()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go db.serveReplica(conn)
+	}
+}
+
+// replicator keeps the state of a primary.
+type replicator struct {
+	enabled atomic.Bool
+
+	mu        sync.Mutex
+	id        string
+	seq       uint64
+	backlog   []mutation
+	followers map[*follower]struct{}
+	closed    bool
+}
+
+// follower is a connected replica.
+type follower struct {
+	conn    net.Conn
+	batches chan []mutation
+}
+
+// enable starts recording mutations.
+func (r *replicator) enable() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.id == "" {
+		var id [8]byte
+		rand.Read(id[:])
+		r.id = hex.EncodeToString(id[:])
+		r.followers = make(map[*follower]struct{})
+	}
+	r.enabled.Store(true)
+}
+
+// publish numbers the mutations of a committed transaction and sends them to
+// all replicas. It must be called in commit order.
+func (r *replicator) publish(mutations []mutation) {
+	if len(mutations) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range mutations {
+		r.seq++
+		mutations[i].Seq = r.seq
+	}
+
+	r.backlog = append(r.backlog, mutations...)
+	if len(r.backlog) > 2*replicationBacklog {
+		r.backlog = append([]mutation(nil), r.backlog[len(r.backlog)-replicationBacklog:]...)
+	}
+
+	for f := range r.followers {
+		select {
+		case f.batches <- mutations:
+		default:
+			// too slow, it resyncs when it reconnects
+			r.remove(f)
+		}
+	}
+}
+
+// since returns the mutations after seq of the run id, or false if they are
+// no longer in the backlog.
+func (r *replicator) since(id string, seq uint64) ([]mutation, bool) {
+	backlog := r.backlog
+	if len(backlog) > replicationBacklog {
+		backlog = backlog[len(backlog)-replicationBacklog:]
+	}
+
+	if id != r.id || seq > r.seq || seq < r.seq-uint64(len(backlog)) {
+		return nil, false
+	}
+
+	return append([]mutation(nil), backlog[len(backlog)-int(r.seq-seq):]...), true
+}
+
+// remove disconnects a replica. r.mu must be held.
+func (r *replicator) remove(f *follower) {
+	if _, ok := r.followers[f]; !ok {
+		return
+	}
+
+	delete(r.followers, f)
+	close(f.batches)
+	f.conn.Close()
+}
+
+// close disconnects all replicas.
+func (r *replicator) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for f := range r.followers {
+		r.remove(f)
+	}
+	r.closed = true
+}
+
+// serveReplica streams mutations to a replica until it disconnects.
+func (db *DB) serveReplica(conn net.Conn) {
+	defer conn.Close()
+
+	var hello replicaHello
+	if err := gob.NewDecoder(conn).Decode(&hello); err != nil {
+		return
+	}
+
+	first, f, err := db.addFollower(conn, hello)
+	if err != nil {
+		return
+	}
+
+	// notice when the replica goes away
+	go func() {
+		io.Copy(io.Discard, conn)
+		db.repl.mu.Lock()
+		db.repl.remove(f)
+		db.repl.mu.Unlock()
+	}()
+
+	w := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(w)
+
+	msg := first
+	for {
+		if err := enc.Encode(msg); err != nil {
+			break
+		}
+
+		// send everything that is ready in one write
+		var ok bool
+		if len(f.batches) == 0 {
+			if err := w.Flush(); err != nil {
+				break
+			}
+		}
+		msg = replicationMessage{}
+		if msg.Mutations, ok = <-f.batches; !ok {
+			break
+		}
+	}
+
+	db.repl.mu.Lock()
+	db.repl.remove(f)
+	db.repl.mu.Unlock()
+}
+
+// addFollower registers a replica and returns the first message to send to
+// it. Holding the write lock keeps the message consistent with the
+// mutations that follow.
+func (db *DB) addFollower(conn net.Conn, hello replicaHello) (replicationMessage, *follower, error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	r := &db.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return replicationMessage{}, nil, bunt.ErrDatabaseClosed
+	}
+
+	msg := replicationMessage{ID: r.id, Seq: r.seq}
+
+	if mutations, ok := r.since(hello.ID, hello.Seq); ok {
+		msg.Mutations = mutations
+	} else {
+		var buf bytes.Buffer
+		if err := db.db.Save(&buf); err != nil {
+			return replicationMessage{}, nil, err
+		}
+		msg.Full = true
+		msg.Snapshot = buf.Bytes()
+	}
+
+	f := &follower{conn: conn, batches: make(chan []mutation, replicationBuffer)}
+	r.followers[f] = struct{}{}
+
+	return msg, f, nil
+}
+
+// ReplicaStatus describes the state of a replica.
+type ReplicaStatus struct {
+	// Primary is the address of the primary.
+	Primary string
+	// Connected reports whether the replica is connected to the primary.
+	Connected bool
+	// Seq is the sequence number of the last mutation applied.
+	Seq uint64
+	// LastSync is the time of the last full resync.
+	LastSync time.Time
+}
+
+// replicaState keeps the state of a replica.
+type replicaState struct {
+	mu        sync.Mutex
+	id        string
+	seq       uint64
+	connected bool
+	lastSync  time.Time
+}
+
+// ReplicaStatus returns the state of a replica. The zero value is returned
+// for databases that are not replicas.
+func (db *DB) ReplicaStatus() ReplicaStatus {
+	if db.opts.replicaOf == "" {
+		return ReplicaStatus{}
+	}
+
+	s := &db.replica
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return ReplicaStatus{Primary: db.opts.replicaOf, Connected: s.connected, Seq: s.seq, LastSync: s.lastSync}
+}
+
+// follow follows the primary at addr until stop is closed, waiting retry
+// before reconnecting.
+func (db *DB) follow(addr string, retry time.Duration, stop <-chan struct{}) {
+	for {
+		// errors are retried after a delay
+		db.followOnce(addr, stop)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// followOnce connects to the primary and applies its messages until the
+// connection fails.
+func (db *DB) followOnce(addr string, stop <-chan struct{}) error {
+	conn, err := net.DialTimeout("tcp", addr, replicaDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	s := &db.replica
+	s.mu.Lock()
+	hello := replicaHello{ID: s.id, Seq: s.seq}
+	s.mu.Unlock()
+
+	if err := gob.NewEncoder(conn).Encode(hello); err != nil {
+		return err
+	}
+
+	defer func() {
+		s.mu.Lock()
+		s.connected = false
+		s.mu.Unlock()
+	}()
+
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+	for {
+		var msg replicationMessage
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+
+		if err := db.applyReplication(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// applyReplication applies a message of the primary.
+func (db *DB) applyReplication(msg replicationMessage) error {
+	s := &db.replica
+	update := func(fn func(tx *Tx) error) error {
+		return db.update(context.Background(), db.db, fn)
+	}
+
+	if msg.Full {
+		if err := db.restore(bytes.NewReader(msg.Snapshot), RestoreReplace, update); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.id, s.seq, s.connected, s.lastSync = msg.ID, msg.Seq, true, time.Now()
+		s.mu.Unlock()
+	} else if msg.ID != "" {
+		s.mu.Lock()
+		s.id, s.connected = msg.ID, true
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	seq := s.seq
+	s.mu.Unlock()
+
+	var last uint64
+	err := update(func(tx *Tx) error {
+		for _, m := range msg.Mutations {
+			if m.Seq <= seq {
+				// already applied
+				continue
+			}
+			last = m.Seq
+
+			collection, key := splitKey(m.Key)
+			if m.Type == EventSet {
+				// an undecodable value is still stored, it is only reported
+				// to watchers as empty
+				value, _ := db.decodeValue(m.Value)
+				if err := tx.setStoredKey(m.Key, collection, key, m.Value, value, expiryOptions(m.TTL)); err != nil {
+					return err
+				}
+			} else if err := tx.deleteKey(m.Key, collection, key, m.Type); err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if last > 0 {
+		s.mu.Lock()
+		s.seq = last
+		s.mu.Unlock()
+	}
+
+	return nil
+}
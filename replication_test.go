@@ -0,0 +1,219 @@
+package swmemdb
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// replicationTestServer serves replication of db on a local port and returns
+// its address.
+func replicationTestServer(t *testing.T, db *DB) (string, net.Listener) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v, want %v", err, "nil")
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go ServeReplication(ln, db)
+
+	return ln.Addr().String(), ln
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// replicaValue returns the value of a key on a replica, or "" if missing.
+func replicaValue(db *DB, collection, key string) string {
+	value, err := db.GetFromCollection(collection, key)
+	if err != nil {
+		return ""
+	}
+
+	return value.(string)
+}
+
+// Test a replica receives a snapshot and then follows the primary
+func TestReplication(t *testing.T) {
+	primary := NewBuntDb(WithMode("memory"))
+	defer primary.Close()
+
+	primary.SetToCollection("users", "alice", "1")
+	primary.SetToCollection("users", "bob", "2")
+
+	addr, _ := replicationTestServer(t, primary)
+
+	replica := NewBuntDb(WithMode("memory"), WithReplicaOf(addr))
+	defer replica.Close()
+
+	waitFor(t, "snapshot", func() bool {
+		return replicaValue(replica, "users", "bob") == "2"
+	})
+
+	if status := replica.ReplicaStatus(); !status.Connected || status.Primary != addr || status.LastSync.IsZero() {
+		t.Errorf("ReplicaStatus() = %+v, want connected after a full sync", status)
+	}
+
+	// stream mutations
+	primary.SetToCollection("users", "carol", "3", time.Hour)
+	primary.UpdateToCollection("users", "alice", "10")
+	primary.DeleteFromCollection("users", "bob")
+	primary.SetToCollection("orders", "1", "x")
+
+	waitFor(t, "mutations", func() bool {
+		return replicaValue(replica, "orders", "1") == "x"
+	})
+
+	if value := replicaValue(replica, "users", "alice"); value != "10" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "10")
+	}
+
+	if _, err := replica.GetFromCollection("users", "bob"); err != ErrNotFound {
+		t.Errorf("GetFromCollection() = %v, want %v", err, ErrNotFound)
+	}
+
+	ttl, err := replica.TTLInCollection("users", "carol")
+	if err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("TTLInCollection() = %v, %v, want at most %v", ttl, err, time.Hour)
+	}
+
+	// expirations are replicated
+	primary.SetToCollection("sessions", "1", "x", 10*time.Millisecond)
+	waitFor(t, "expiration", func() bool {
+		keys, _ := replica.GetKeysFromCollection("sessions")
+		return replica.ReplicaStatus().Seq >= 6 && len(keys) == 0
+	})
+}
+
+// Test writes to a replica fail
+func TestReplicaReadOnly(t *testing.T) {
+	replica := NewBuntDb(WithMode("memory"), WithReplicaOf("127.0.0.1:1"))
+	defer replica.Close()
+
+	if err := replica.SetToCollection("users", "alice", "1"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetToCollection() = %v, want %v", err, ErrReadOnly)
+	}
+
+	if err := replica.DropCollection("users"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DropCollection() = %v, want %v", err, ErrReadOnly)
+	}
+
+	if status := replica.ReplicaStatus(); status.Connected {
+		t.Errorf("ReplicaStatus() = %+v, want not connected", status)
+	}
+}
+
+// Test a replica catches up after losing its connection
+func TestReplicationReconnect(t *testing.T) {
+	delay := replicaRetryDelay
+	replicaRetryDelay = 10 * time.Millisecond
+	defer func() { replicaRetryDelay = delay }()
+
+	primary := NewBuntDb(WithMode("memory"))
+	defer primary.Close()
+
+	addr, _ := replicationTestServer(t, primary)
+
+	replica := NewBuntDb(WithMode("memory"), WithReplicaOf(addr))
+	defer replica.Close()
+
+	primary.SetToCollection("users", "alice", "1")
+	waitFor(t, "alice", func() bool {
+		return replicaValue(replica, "users", "alice") == "1"
+	})
+	lastSync := replica.ReplicaStatus().LastSync
+
+	// drop the connection, the replica resumes from the backlog
+	primary.repl.mu.Lock()
+	for f := range primary.repl.followers {
+		primary.repl.remove(f)
+	}
+	primary.repl.mu.Unlock()
+
+	primary.SetToCollection("users", "bob", "2")
+	waitFor(t, "bob", func() bool {
+		return replicaValue(replica, "users", "bob") == "2"
+	})
+
+	if status := replica.ReplicaStatus(); !status.LastSync.Equal(lastSync) {
+		t.Errorf("ReplicaStatus() = %+v, want no full resync", status)
+	}
+}
+
+// Test replicator.since
+func TestReplicatorSince(t *testing.T) {
+	var r replicator
+	r.enable()
+
+	for i := 0; i < replicationBacklog+10; i++ {
+		r.publish([]mutation{{Type: EventSet, Key: "k:1", Value: "v"}})
+	}
+
+	mutations, ok := r.since(r.id, r.seq-2)
+	if !ok || len(mutations) != 2 || mutations[0].Seq != r.seq-1 {
+		t.Errorf("since() = %v, %v, want the last %d mutations", len(mutations), ok, 2)
+	}
+
+	if _, ok := r.since(r.id, 5); ok {
+		t.Errorf("since() = %v, want %v", ok, false)
+	}
+
+	if _, ok := r.since("other", r.seq); ok {
+		t.Errorf("since() = %v, want %v", ok, false)
+	}
+
+	if mutations, ok := r.since(r.id, r.seq); !ok || len(mutations) != 0 {
+		t.Errorf("since() = %v, %v, want no mutations", len(mutations), ok)
+	}
+}
+
+// Test rotating the encryption key is replicated
+func TestReplicationRotateEncryptionKey(t *testing.T) {
+	primary := NewBuntDb(WithMode("memory"), WithEncryption(testKey1))
+	defer primary.Close()
+
+	primary.SetToCollection("users", "alice", "1")
+
+	addr, _ := replicationTestServer(t, primary)
+
+	replica := NewBuntDb(WithMode("memory"), WithReplicaOf(addr), WithEncryption(testKey1))
+	defer replica.Close()
+
+	waitFor(t, "snapshot", func() bool {
+		return replicaValue(replica, "users", "alice") == "1"
+	})
+
+	if err := primary.RotateEncryptionKey(testKey1, testKey2); err != nil {
+		t.Fatalf("RotateEncryptionKey() = %v, want %v", err, "nil")
+	}
+
+	// replicas hold the values encrypted with the new key
+	stored := func(db *DB, key string) string {
+		var value string
+		db.db.View(func(tx *bunt.Tx) error {
+			value, _ = tx.Get(key)
+			return nil
+		})
+		return value
+	}
+
+	for _, key := range []string{"users:alice", encryptionCheckKey} {
+		want := stored(primary, key)
+		waitFor(t, key, func() bool {
+			return stored(replica, key) == want
+		})
+	}
+}
@@ -0,0 +1,703 @@
+package swmemdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+const (
+	// maxRESPArgs is the largest number of arguments of a RESP command.
+	maxRESPArgs = 1024 * 1024
+	// maxRESPBulk is the largest bulk string accepted by the RESP server.
+	maxRESPBulk = 512 * 1024 * 1024
+	// respArgsPrealloc is the largest number of arguments space is reserved
+	// for before they arrive.
+	respArgsPrealloc = 64
+	// defaultRESPScanCount is the number of keys examined by SCAN by default.
+	defaultRESPScanCount = 10
+	// maxRESPCursors is the number of SCAN cursors a server remembers.
+	maxRESPCursors = 4096
+)
+
+// errRESPProtocol is returned when a client sends malformed input.
+var errRESPProtocol = errors.New("ERR Protocol error")
+
+// ServeRESP accepts connections on ln and serves db over the Redis
+// serialization protocol (RESP2) until ln is closed. Every connection starts
+// in the default collection of db; SELECT switches to another collection.
+//
+// Supported commands are GET, SET (with EX, PX, NX and XX), DEL, EXISTS, TTL,
+// EXPIRE, KEYS, SCAN, SELECT, PING, INFO and QUIT. A SCAN cursor resumes
+// after the last key it examined, so keys that exist during the whole scan
+// are returned even if others are deleted. The server remembers the last
+// 4096 cursors; older ones fail with an invalid cursor error.
+func ServeRESP(ln net.Listener, db *DB) error {
+	cursors := &respCursors{keys: make(map[uint64]string)}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go (&respConn{
+			db:         db,
+			conn:       conn,
+			r:          bufio.NewReader(conn),
+			w:          bufio.NewWriter(conn),
+			collection: db.collection,
+			cursors:    cursors,
+		}).serve()
+	}
+}
+
+// respConn is a single client connection of the RESP server.
+type respConn struct {
+	db         *DB
+	conn       net.Conn
+	r          *bufio.Reader
+	w          *bufio.Writer
+	collection string
+	cursors    *respCursors
+}
+
+// respCursors maps SCAN cursors to the database key a scan resumes after.
+// They are shared by the connections of a server, since clients may go on
+// with a scan on another connection.
+type respCursors struct {
+	mu    sync.Mutex
+	last  uint64
+	keys  map[uint64]string
+	order []uint64
+}
+
+// add returns a new cursor resuming after key, forgetting the oldest cursor
+// if there are too many.
+func (cs *respCursors) add(key string) uint64 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.last++
+	cs.keys[cs.last] = key
+	cs.order = append(cs.order, cs.last)
+	if len(cs.order) > maxRESPCursors {
+		delete(cs.keys, cs.order[0])
+		cs.order = cs.order[1:]
+	}
+
+	return cs.last
+}
+
+// get returns the key a cursor resumes after.
+func (cs *respCursors) get(cursor uint64) (string, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key, ok := cs.keys[cursor]
+	return key, ok
+}
+
+// serve reads and executes commands until the client disconnects.
+func (c *respConn) serve() {
+	defer c.conn.Close()
+
+	for {
+		args, err := c.readCommand()
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				c.writeError(err.Error())
+				c.w.Flush()
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := c.execute(args)
+
+		// flush once all pipelined commands have been handled
+		if quit || c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+
+		if quit {
+			return
+		}
+	}
+}
+
+// readCommand reads a command as a RESP array of bulk strings or as an
+// inline command.
+func (c *respConn) readCommand() ([]string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < -1 || n > maxRESPArgs {
+		return nil, errRESPProtocol
+	}
+
+	// a null array is an empty command
+	if n == -1 {
+		return nil, nil
+	}
+
+	// memory is taken as the data arrives, not as announced by the client
+	prealloc := n
+	if prealloc > respArgsPrealloc {
+		prealloc = respArgsPrealloc
+	}
+
+	args := make([]string, 0, prealloc)
+	for i := 0; i < n; i++ {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errRESPProtocol
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxRESPBulk {
+			return nil, errRESPProtocol
+		}
+
+		var arg strings.Builder
+		if _, err := io.CopyN(&arg, c.r, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		var end [2]byte
+		if _, err := io.ReadFull(c.r, end[:]); err != nil {
+			return nil, err
+		}
+
+		if end != [2]byte{'\r', '\n'} {
+			return nil, errRESPProtocol
+		}
+
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// readLine reads a line without its line ending.
+func (c *respConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// execute runs a command and writes its reply. It reports whether the
+// connection should be closed.
+func (c *respConn) execute(args []string) (quit bool) {
+	name := strings.ToLower(args[0])
+	args = args[1:]
+
+	switch name {
+	case "ping":
+		c.ping(args)
+	case "quit":
+		c.writeSimple("OK")
+		return true
+	case "select":
+		c.selectCollection(args)
+	case "get":
+		c.get(args)
+	case "set":
+		c.set(args)
+	case "del":
+		c.del(args)
+	case "exists":
+		c.exists(args)
+	case "ttl":
+		c.ttl(args)
+	case "expire":
+		c.expire(args)
+	case "keys":
+		c.keys(args)
+	case "scan":
+		c.scan(args)
+	case "info":
+		c.info(args)
+	case "command":
+		// clients such as redis-cli ask for the command table on connect
+		c.writeArray(nil)
+	default:
+		c.writeError(fmt.Sprintf("ERR unknown command '%s'", name))
+	}
+
+	return false
+}
+
+// ping implements PING [message].
+func (c *respConn) ping(args []string) {
+	switch len(args) {
+	case 0:
+		c.writeSimple("PONG")
+	case 1:
+		c.writeBulk(args[0])
+	default:
+		c.writeArity("ping")
+	}
+}
+
+// selectCollection implements SELECT collection.
+func (c *respConn) selectCollection(args []string) {
+	if len(args) != 1 {
+		c.writeArity("select")
+		return
+	}
+
+	if args[0] == "" {
+		c.writeError("ERR invalid collection")
+		return
+	}
+
+	c.collection = args[0]
+	c.writeSimple("OK")
+}
+
+// get implements GET key.
+func (c *respConn) get(args []string) {
+	if len(args) != 1 {
+		c.writeArity("get")
+		return
+	}
+
+	var value string
+	err := c.db.View(func(tx *Tx) error {
+		var err error
+		value, err = tx.Get(c.collection, args[0])
+		return err
+	})
+	if err == ErrNotFound {
+		c.writeNull()
+		return
+	} else if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.writeBulk(value)
+}
+
+// set implements SET key value [EX seconds|PX milliseconds] [NX|XX].
+func (c *respConn) set(args []string) {
+	if len(args) < 2 {
+		c.writeArity("set")
+		return
+	}
+
+	key, value := args[0], args[1]
+
+	var exp time.Duration
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if exp != 0 || i+1 == len(args) {
+				c.writeError("ERR syntax error")
+				return
+			}
+
+			unit := time.Second
+			if strings.ToLower(args[i]) == "px" {
+				unit = time.Millisecond
+			}
+
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			var ok bool
+			if exp, ok = respDuration(n, unit); err != nil || n <= 0 || !ok {
+				c.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			i++
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	if nx && xx {
+		c.writeError("ERR syntax error")
+		return
+	}
+
+	var skipped bool
+	err := c.db.Tx(func(tx *Tx) error {
+		if nx || xx {
+			_, err := tx.get(c.collection, key)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+
+			exists := err == nil
+			if (nx && exists) || (xx && !exists) {
+				skipped = true
+				return nil
+			}
+		}
+
+		return tx.Set(c.collection, key, value, exp)
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if skipped {
+		c.writeNull()
+		return
+	}
+
+	c.writeSimple("OK")
+}
+
+// del implements DEL key [key ...].
+func (c *respConn) del(args []string) {
+	if len(args) == 0 {
+		c.writeArity("del")
+		return
+	}
+
+	var deleted int64
+	err := c.db.Tx(func(tx *Tx) error {
+		for _, key := range args {
+			err := tx.Delete(c.collection, key)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.writeInt(deleted)
+}
+
+// exists implements EXISTS key [key ...].
+func (c *respConn) exists(args []string) {
+	if len(args) == 0 {
+		c.writeArity("exists")
+		return
+	}
+
+	var found int64
+	err := c.db.View(func(tx *Tx) error {
+		for _, key := range args {
+			_, err := tx.get(c.collection, key)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			found++
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.writeInt(found)
+}
+
+// ttl implements TTL key.
+func (c *respConn) ttl(args []string) {
+	if len(args) != 1 {
+		c.writeArity("ttl")
+		return
+	}
+
+	var ttl time.Duration
+	err := c.db.View(func(tx *Tx) error {
+		var err error
+		ttl, err = tx.TTL(c.collection, args[0])
+		return err
+	})
+	switch {
+	case err == ErrNotFound:
+		c.writeInt(-2)
+	case err != nil:
+		c.writeErr(err)
+	case ttl == NoExpiration:
+		c.writeInt(-1)
+	default:
+		c.writeInt(int64(ttl.Round(time.Second) / time.Second))
+	}
+}
+
+// expire implements EXPIRE key seconds.
+func (c *respConn) expire(args []string) {
+	if len(args) != 2 {
+		c.writeArity("expire")
+		return
+	}
+
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	d, ok := respDuration(seconds, time.Second)
+	if !ok {
+		c.writeError("ERR invalid expire time in 'expire' command")
+		return
+	}
+
+	err = c.db.Tx(func(tx *Tx) error {
+		return tx.Expire(c.collection, args[0], d)
+	})
+	switch {
+	case err == ErrNotFound:
+		c.writeInt(0)
+	case err != nil:
+		c.writeErr(err)
+	default:
+		c.writeInt(1)
+	}
+}
+
+// respDuration returns n units as a duration, reporting false if it does not
+// fit.
+func respDuration(n int64, unit time.Duration) (time.Duration, bool) {
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
+
+// keys implements KEYS pattern.
+func (c *respConn) keys(args []string) {
+	if len(args) != 1 {
+		c.writeArity("keys")
+		return
+	}
+
+	var keys []string
+	err := c.db.View(func(tx *Tx) error {
+		return tx.tx.AscendKeys(collectionKey(c.collection, args[0]), func(key, value string) bool {
+			if key = key[len(c.collection)+1:]; !isElementKey(key) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.writeArray(keys)
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count]. The cursor is
+// the number of keys of the collection examined so far.
+func (c *respConn) scan(args []string) {
+	if len(args) == 0 {
+		c.writeArity("scan")
+		return
+	}
+
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		c.writeError("ERR invalid cursor")
+		return
+	}
+
+	// start at the first key of the collection, or right after the last
+	// key examined
+	prefix := collectionKey(c.collection, "")
+	start := prefix
+	if cursor != 0 {
+		after, ok := c.cursors.get(cursor)
+		if !ok || !strings.HasPrefix(after, prefix) {
+			c.writeError("ERR invalid cursor")
+			return
+		}
+		start = after + "\x00"
+	}
+
+	pattern := "*"
+	count := uint64(defaultRESPScanCount)
+	for i := 1; i < len(args); i++ {
+		if i+1 == len(args) {
+			c.writeError("ERR syntax error")
+			return
+		}
+
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			count, err = strconv.ParseUint(args[i+1], 10, 64)
+			if err != nil || count == 0 {
+				c.writeError("ERR syntax error")
+				return
+			}
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+		i++
+	}
+
+	var keys []string
+	var examined uint64
+	var last string
+	var more bool
+	err = c.db.View(func(tx *Tx) error {
+		return tx.tx.AscendGreaterOrEqual("", start, func(dbKey, value string) bool {
+			if !strings.HasPrefix(dbKey, prefix) {
+				return false
+			}
+
+			key := dbKey[len(prefix):]
+			if isElementKey(key) {
+				return true
+			}
+
+			if examined == count {
+				more = true
+				return false
+			}
+
+			examined++
+			last = dbKey
+			if bunt.Match(key, pattern) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	next := "0"
+	if more {
+		next = strconv.FormatUint(c.cursors.add(last), 10)
+	}
+
+	c.w.WriteString("*2\r\n")
+	c.writeBulk(next)
+	c.writeArray(keys)
+}
+
+// info implements INFO [section].
+func (c *respConn) info(args []string) {
+	if len(args) > 1 {
+		c.writeArity("info")
+		return
+	}
+
+	collections, err := c.db.ListCollections()
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	b.WriteString("server:swmemdb\r\n")
+	fmt.Fprintf(&b, "mode:%s\r\n", c.db.mode)
+	fmt.Fprintf(&b, "default_collection:%s\r\n", c.db.collection)
+	b.WriteString("\r\n# Keyspace\r\n")
+	for _, name := range collections {
+		stats, err := c.db.CollectionStats(name)
+		if err != nil {
+			c.writeErr(err)
+			return
+		}
+		fmt.Fprintf(&b, "%s:keys=%d,expires=%d\r\n", name, stats.Keys, stats.KeysWithTTL)
+	}
+
+	c.writeBulk(b.String())
+}
+
+// writeSimple writes a simple string reply.
+func (c *respConn) writeSimple(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+// writeError writes an error reply.
+func (c *respConn) writeError(s string) {
+	c.w.WriteString("-" + s + "\r\n")
+}
+
+// writeErr writes err as an error reply.
+func (c *respConn) writeErr(err error) {
+	c.writeError("ERR " + strings.ReplaceAll(err.Error(), "\r\n", " "))
+}
+
+// writeArity writes the error for a wrong number of arguments.
+func (c *respConn) writeArity(name string) {
+	c.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+}
+
+// writeInt writes an integer reply.
+func (c *respConn) writeInt(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// writeBulk writes a bulk string reply.
+func (c *respConn) writeBulk(s string) {
+	c.w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+// writeNull writes a null bulk string reply.
+func (c *respConn) writeNull() {
+	c.w.WriteString("$-1\r\n")
+}
+
+// writeArray writes an array of bulk strings reply.
+func (c *respConn) writeArray(items []string) {
+	c.w.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		c.writeBulk(item)
+	}
+}
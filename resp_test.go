@@ -0,0 +1,330 @@
+package swmemdb
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// respTestClient is a minimal RESP client.
+type respTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// respTestServer starts a RESP server for db and connects a client to it.
+func respTestServer(t *testing.T, db *DB) *respTestClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v, want %v", err, "nil")
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go ServeRESP(ln, db)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() = %v, want %v", err, "nil")
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	return &respTestClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends a command and returns the reply. Simple strings are returned with
+// a leading '+', errors with a leading '-', integers as int64, null as nil
+// and arrays as []interface{}.
+func (c *respTestClient) do(args ...string) interface{} {
+	c.t.Helper()
+
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatalf("Write() = %v, want %v", err, "nil")
+	}
+
+	return c.read()
+}
+
+// read reads a single reply.
+func (c *respTestClient) read() interface{} {
+	c.t.Helper()
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("ReadString() = %v, want %v", err, "nil")
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+', '-':
+		return line
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatalf("ReadFull() = %v, want %v", err, "nil")
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := []interface{}{}
+		for i := 0; i < n; i++ {
+			items = append(items, c.read())
+		}
+		return items
+	}
+
+	c.t.Fatalf("read() = %q, want %v", line, "reply")
+	return nil
+}
+
+// Test PING, SET, GET, EXISTS and DEL
+func TestRESPBasicCommands(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	for _, tc := range []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"ping", "hello"}, "hello"},
+		{[]string{"GET", "name"}, nil},
+		{[]string{"SET", "name", "alice"}, "+OK"},
+		{[]string{"GET", "name"}, "alice"},
+		{[]string{"SET", "name", "bob", "NX"}, nil},
+		{[]string{"SET", "other", "bob", "XX"}, nil},
+		{[]string{"SET", "name", "bob", "XX"}, "+OK"},
+		{[]string{"GET", "name"}, "bob"},
+		{[]string{"EXISTS", "name", "other", "name"}, int64(2)},
+		{[]string{"DEL", "name", "other"}, int64(1)},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'flushall'"},
+	} {
+		if got := c.do(tc.args...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v = %#v, want %#v", tc.args, got, tc.want)
+		}
+	}
+}
+
+// Test SET with expirations, TTL and EXPIRE
+func TestRESPExpiration(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	for _, tc := range []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"SET", "a", "1", "EX", "100"}, "+OK"},
+		{[]string{"TTL", "a"}, int64(100)},
+		{[]string{"SET", "b", "2", "PX", "5000"}, "+OK"},
+		{[]string{"TTL", "b"}, int64(5)},
+		{[]string{"SET", "c", "3"}, "+OK"},
+		{[]string{"TTL", "c"}, int64(-1)},
+		{[]string{"TTL", "missing"}, int64(-2)},
+		{[]string{"EXPIRE", "c", "50"}, int64(1)},
+		{[]string{"TTL", "c"}, int64(50)},
+		{[]string{"EXPIRE", "missing", "50"}, int64(0)},
+		{[]string{"SET", "d", "4", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "d", "4", "EX"}, "-ERR syntax error"},
+		// durations that overflow are refused
+		{[]string{"SET", "d", "4", "EX", "9223372036854775"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "d", "4", "PX", "9223372036855"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"EXISTS", "d"}, int64(0)},
+		{[]string{"EXPIRE", "c", "9223372036854775"}, "-ERR invalid expire time in 'expire' command"},
+		{[]string{"TTL", "c"}, int64(50)},
+	} {
+		if got := c.do(tc.args...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v = %#v, want %#v", tc.args, got, tc.want)
+		}
+	}
+}
+
+// Test SELECT, KEYS and SCAN
+func TestRESPCollections(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	for _, key := range []string{"user:1", "user:2", "user:3", "order:1"} {
+		err := db.SetToCollection("app", key, "x")
+		if err != nil {
+			t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+		}
+	}
+
+	// the elements of a hash are not listed
+	for _, field := range []string{"a", "b"} {
+		if err := db.HSet("app", "user:4", field, "x"); err != nil {
+			t.Errorf("HSet() = %v, want %v", err, "nil")
+		}
+	}
+
+	if got := c.do("KEYS", "*"); !reflect.DeepEqual(got, []interface{}{}) {
+		t.Errorf("KEYS = %#v, want %#v", got, []interface{}{})
+	}
+
+	if got := c.do("SELECT", "app"); got != "+OK" {
+		t.Errorf("SELECT = %#v, want %#v", got, "+OK")
+	}
+
+	want := []interface{}{"user:1", "user:2", "user:3", "user:4"}
+	if got := c.do("KEYS", "user:*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("KEYS = %#v, want %#v", got, want)
+	}
+
+	var keys []interface{}
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "2").([]interface{})
+		cursor = reply[0].(string)
+		keys = append(keys, reply[1].([]interface{})...)
+		if cursor == "0" {
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("SCAN = %#v, want %#v", keys, want)
+	}
+
+	info := c.do("INFO").(string)
+	if !strings.Contains(info, "app:keys=5,expires=0") {
+		t.Errorf("INFO = %v, want %v", info, "app:keys=5,expires=0")
+	}
+}
+
+// Test SCAN does not skip keys when others are deleted between calls
+func TestRESPScanDelete(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if err := db.Set(key, "x", 0); err != nil {
+			t.Errorf("Set() = %v, want %v", err, "nil")
+		}
+	}
+
+	reply := c.do("SCAN", "0", "COUNT", "2").([]interface{})
+	keys := reply[1].([]interface{})
+	if want := []interface{}{"a", "b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("SCAN = %#v, want %#v", keys, want)
+	}
+
+	if err := db.Delete("a"); err != nil {
+		t.Errorf("Delete() = %v, want %v", err, "nil")
+	}
+
+	reply = c.do("SCAN", reply[0].(string), "COUNT", "2").([]interface{})
+	if want := []interface{}{"0", []interface{}{"c", "d"}}; !reflect.DeepEqual(reply, want) {
+		t.Errorf("SCAN = %#v, want %#v", reply, want)
+	}
+
+	if got := c.do("SCAN", "12345"); got != "-ERR invalid cursor" {
+		t.Errorf("SCAN = %#v, want %#v", got, "-ERR invalid cursor")
+	}
+}
+
+// Test inline commands and pipelining
+func TestRESPInlineAndPipeline(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	_, err := c.conn.Write([]byte("SET a 1\r\nGET a\r\nPING\r\n"))
+	if err != nil {
+		t.Fatalf("Write() = %v, want %v", err, "nil")
+	}
+
+	for _, want := range []interface{}{"+OK", "1", "+PONG"} {
+		if got := c.read(); got != want {
+			t.Errorf("read() = %#v, want %#v", got, want)
+		}
+	}
+
+	if got := c.do("QUIT"); got != "+OK" {
+		t.Errorf("QUIT = %#v, want %#v", got, "+OK")
+	}
+}
+
+// Test negative array lengths do not bring the server down
+func TestRESPNegativeArray(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	// a null array is ignored
+	if _, err := c.conn.Write([]byte("*-1\r\n")); err != nil {
+		t.Fatalf("Write() = %v, want %v", err, "nil")
+	}
+	if got := c.do("PING"); got != "+PONG" {
+		t.Errorf("PING = %#v, want %#v", got, "+PONG")
+	}
+
+	// other negative lengths are protocol errors
+	if _, err := c.conn.Write([]byte("*-5\r\n")); err != nil {
+		t.Fatalf("Write() = %v, want %v", err, "nil")
+	}
+	if got := c.read(); got != "-ERR Protocol error" {
+		t.Errorf("read() = %#v, want %#v", got, "-ERR Protocol error")
+	}
+
+	// the server still answers new clients
+	conn, err := net.Dial("tcp", c.conn.RemoteAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() = %v, want %v", err, "nil")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	c = &respTestClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	if got := c.do("PING"); got != "+PONG" {
+		t.Errorf("PING = %#v, want %#v", got, "+PONG")
+	}
+}
+
+// Test announced lengths do not reserve memory before the data arrives
+func TestRESPLargeHeaders(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+	c := respTestServer(t, db)
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	if _, err := c.conn.Write([]byte("*1000000\r\n$536870000\r\nabc")); err != nil {
+		t.Fatalf("Write() = %v, want %v", err, "nil")
+	}
+	c.conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Errorf("TotalAlloc grew by %d bytes, want at most %d", allocated, 16<<20)
+	}
+}
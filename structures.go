@@ -0,0 +1,736 @@
+package swmemdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// Hashes, lists and sets are stored in a collection as a header key holding
+// the kind of the structure, and one key per element named after the header
+// key, a NUL byte and the field, member or list index. All keys of a
+// structure share the expiration of its header: Expire and Persist apply to
+// the whole structure, and Delete deletes its elements too. Elements are
+// left out of key listings, so keys containing a NUL byte are reserved.
+
+// Tags starting the header of a structure.
+const (
+	hashTag = "\x00swhash\x00"
+	listTag = "\x00swlist\x00"
+	setTag  = "\x00swset\x00"
+)
+
+// elementSep separates the key of a structure from the name of an element.
+const elementSep = "\x00"
+
+// structure is the header of a hash, list or set. The elements of a list
+// are numbered from head to tail, exclusive.
+type structure struct {
+	collection string
+	key        string
+	tag        string
+	header     string
+	exists     bool
+	head, tail int64
+	ttl        time.Duration
+}
+
+// HSet sets a field of the hash stored under a key in a collection, creating
+// the hash if needed.
+func (db *DB) HSet(collection, key, field, value string) error {
+	return db.Tx(func(tx *Tx) error {
+		return tx.HSet(collection, key, field, value)
+	})
+}
+
+// HGet gets a field of the hash stored under a key in a collection.
+func (db *DB) HGet(collection, key, field string) (string, error) {
+	var value string
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		value, err = tx.HGet(collection, key, field)
+		return err
+	})
+
+	return value, err
+}
+
+// HGetAll returns all fields of the hash stored under a key in a
+// collection. A missing hash is empty.
+func (db *DB) HGetAll(collection, key string) (map[string]string, error) {
+	var fields map[string]string
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		fields, err = tx.HGetAll(collection, key)
+		return err
+	})
+
+	return fields, err
+}
+
+// HDel deletes fields of the hash stored under a key in a collection and
+// returns the number of deleted fields. The hash is deleted with its last
+// field.
+func (db *DB) HDel(collection, key string, fields ...string) (int, error) {
+	var n int
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		n, err = tx.HDel(collection, key, fields...)
+		return err
+	})
+
+	return n, err
+}
+
+// LPush prepends values to the list stored under a key in a collection,
+// creating the list if needed, and returns the new length of the list.
+func (db *DB) LPush(collection, key string, values ...string) (int, error) {
+	var n int
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		n, err = tx.LPush(collection, key, values...)
+		return err
+	})
+
+	return n, err
+}
+
+// RPush appends values to the list stored under a key in a collection,
+// creating the list if needed, and returns the new length of the list.
+func (db *DB) RPush(collection, key string, values ...string) (int, error) {
+	var n int
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		n, err = tx.RPush(collection, key, values...)
+		return err
+	})
+
+	return n, err
+}
+
+// LPop removes and returns the first value of the list stored under a key in
+// a collection. The list is deleted with its last value.
+func (db *DB) LPop(collection, key string) (string, error) {
+	var value string
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		value, err = tx.LPop(collection, key)
+		return err
+	})
+
+	return value, err
+}
+
+// RPop removes and returns the last value of the list stored under a key in
+// a collection. The list is deleted with its last value.
+func (db *DB) RPop(collection, key string) (string, error) {
+	var value string
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		value, err = tx.RPop(collection, key)
+		return err
+	})
+
+	return value, err
+}
+
+// LRange returns the values of the list stored under a key in a collection
+// from start to stop, inclusive. Negative indexes count from the end of the
+// list, -1 being the last value.
+func (db *DB) LRange(collection, key string, start, stop int) ([]string, error) {
+	var values []string
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		values, err = tx.LRange(collection, key, start, stop)
+		return err
+	})
+
+	return values, err
+}
+
+// SAdd adds members to the set stored under a key in a collection, creating
+// the set if needed, and returns the number of added members.
+func (db *DB) SAdd(collection, key string, members ...string) (int, error) {
+	var n int
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		n, err = tx.SAdd(collection, key, members...)
+		return err
+	})
+
+	return n, err
+}
+
+// SRem removes members from the set stored under a key in a collection and
+// returns the number of removed members. The set is deleted with its last
+// member.
+func (db *DB) SRem(collection, key string, members ...string) (int, error) {
+	var n int
+
+	err := db.Tx(func(tx *Tx) error {
+		var err error
+		n, err = tx.SRem(collection, key, members...)
+		return err
+	})
+
+	return n, err
+}
+
+// SMembers returns the members of the set stored under a key in a
+// collection in ascending order. A missing set is empty.
+func (db *DB) SMembers(collection, key string) ([]string, error) {
+	var members []string
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.SMembers(collection, key)
+		return err
+	})
+
+	return members, err
+}
+
+// SIsMember reports whether member belongs to the set stored under a key in
+// a collection.
+func (db *DB) SIsMember(collection, key, member string) (bool, error) {
+	var ok bool
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		ok, err = tx.SIsMember(collection, key, member)
+		return err
+	})
+
+	return ok, err
+}
+
+// SInter returns the members of all the sets stored under the given keys in
+// a collection in ascending order.
+func (db *DB) SInter(collection string, keys ...string) ([]string, error) {
+	var members []string
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.SInter(collection, keys...)
+		return err
+	})
+
+	return members, err
+}
+
+// SUnion returns the members of any of the sets stored under the given keys
+// in a collection in ascending order.
+func (db *DB) SUnion(collection string, keys ...string) ([]string, error) {
+	var members []string
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.SUnion(collection, keys...)
+		return err
+	})
+
+	return members, err
+}
+
+// HSet sets a field of a hash, see DB.HSet.
+func (tx *Tx) HSet(collection, key, field, value string) error {
+	s, err := tx.openStructure(collection, key, hashTag)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.setElement(s, field, value); err != nil {
+		return err
+	}
+
+	return tx.saveStructure(s)
+}
+
+// HGet gets a field of a hash, see DB.HGet.
+func (tx *Tx) HGet(collection, key, field string) (string, error) {
+	s, err := tx.structure(collection, key, hashTag)
+	if err != nil {
+		return "", err
+	}
+
+	if !s.exists {
+		return "", ErrNotFound
+	}
+
+	return tx.Get(collection, elementKey(key, field))
+}
+
+// HGetAll returns all fields of a hash, see DB.HGetAll.
+func (tx *Tx) HGetAll(collection, key string) (map[string]string, error) {
+	fields := make(map[string]string)
+
+	s, err := tx.structure(collection, key, hashTag)
+	if err != nil || !s.exists {
+		return fields, err
+	}
+
+	err = tx.elements(s, func(field, value string) bool {
+		fields[field] = value
+		return true
+	})
+
+	return fields, err
+}
+
+// HDel deletes fields of a hash, see DB.HDel.
+func (tx *Tx) HDel(collection, key string, fields ...string) (int, error) {
+	return tx.removeElements(collection, key, hashTag, fields)
+}
+
+// LPush prepends values to a list, see DB.LPush.
+func (tx *Tx) LPush(collection, key string, values ...string) (int, error) {
+	s, err := tx.openStructure(collection, key, listTag)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		s.head--
+		if err := tx.setElement(s, strconv.FormatInt(s.head, 10), value); err != nil {
+			return 0, err
+		}
+	}
+
+	return int(s.tail - s.head), tx.saveStructure(s)
+}
+
+// RPush appends values to a list, see DB.RPush.
+func (tx *Tx) RPush(collection, key string, values ...string) (int, error) {
+	s, err := tx.openStructure(collection, key, listTag)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		if err := tx.setElement(s, strconv.FormatInt(s.tail, 10), value); err != nil {
+			return 0, err
+		}
+		s.tail++
+	}
+
+	return int(s.tail - s.head), tx.saveStructure(s)
+}
+
+// LPop removes and returns the first value of a list, see DB.LPop.
+func (tx *Tx) LPop(collection, key string) (string, error) {
+	return tx.pop(collection, key, true)
+}
+
+// RPop removes and returns the last value of a list, see DB.RPop.
+func (tx *Tx) RPop(collection, key string) (string, error) {
+	return tx.pop(collection, key, false)
+}
+
+// LRange returns a range of the values of a list, see DB.LRange.
+func (tx *Tx) LRange(collection, key string, start, stop int) ([]string, error) {
+	s, err := tx.structure(collection, key, listTag)
+	if err != nil || !s.exists {
+		return nil, err
+	}
+
+	n := int(s.tail - s.head)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	var values []string
+	for i := start; i <= stop; i++ {
+		value, err := tx.get(collection, elementKey(key, strconv.FormatInt(s.head+int64(i), 10)))
+		if err == ErrNotFound {
+			// evicted
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// SAdd adds members to a set, see DB.SAdd.
+func (tx *Tx) SAdd(collection, key string, members ...string) (int, error) {
+	s, err := tx.openStructure(collection, key, setTag)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, member := range members {
+		if _, err := tx.tx.Get(collectionKey(collection, elementKey(key, member))); err == nil {
+			continue
+		}
+
+		if err := tx.setElement(s, member, ""); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	return n, tx.saveStructure(s)
+}
+
+// SRem removes members from a set, see DB.SRem.
+func (tx *Tx) SRem(collection, key string, members ...string) (int, error) {
+	return tx.removeElements(collection, key, setTag, members)
+}
+
+// SMembers returns the members of a set, see DB.SMembers.
+func (tx *Tx) SMembers(collection, key string) ([]string, error) {
+	s, err := tx.structure(collection, key, setTag)
+	if err != nil || !s.exists {
+		return nil, err
+	}
+
+	return tx.elementNames(s)
+}
+
+// SIsMember reports whether member belongs to a set, see DB.SIsMember.
+func (tx *Tx) SIsMember(collection, key, member string) (bool, error) {
+	s, err := tx.structure(collection, key, setTag)
+	if err != nil || !s.exists {
+		return false, err
+	}
+
+	_, err = tx.tx.Get(collectionKey(collection, elementKey(key, member)))
+	if err == ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// SInter returns the intersection of sets, see DB.SInter.
+func (tx *Tx) SInter(collection string, keys ...string) ([]string, error) {
+	counts, err := tx.countMembers(collection, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for member, n := range counts {
+		if n == len(keys) {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+
+	return members, nil
+}
+
+// SUnion returns the union of sets, see DB.SUnion.
+func (tx *Tx) SUnion(collection string, keys ...string) ([]string, error) {
+	counts, err := tx.countMembers(collection, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(counts))
+	for member := range counts {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	return members, nil
+}
+
+// countMembers counts in how many of the sets stored under keys each member
+// is.
+func (tx *Tx) countMembers(collection string, keys []string) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	for _, key := range keys {
+		members, err := tx.SMembers(collection, key)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			counts[member]++
+		}
+	}
+
+	return counts, nil
+}
+
+// pop removes and returns the first or last value of a list.
+func (tx *Tx) pop(collection, key string, first bool) (string, error) {
+	s, err := tx.structure(collection, key, listTag)
+	if err != nil {
+		return "", err
+	}
+
+	for s.head < s.tail {
+		var i int64
+		if first {
+			i = s.head
+			s.head++
+		} else {
+			s.tail--
+			i = s.tail
+		}
+
+		elemKey := elementKey(key, strconv.FormatInt(i, 10))
+		value, err := tx.get(collection, elemKey)
+		if err == ErrNotFound {
+			// evicted
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		if err := tx.delete(collection, elemKey, EventDelete); err != nil {
+			return "", err
+		}
+
+		return value, tx.saveStructure(s)
+	}
+
+	if s.exists {
+		if err := tx.saveStructure(s); err != nil {
+			return "", err
+		}
+	}
+
+	return "", ErrNotFound
+}
+
+// removeElements removes fields or members of a hash or set and returns the
+// number of removed ones. The structure is deleted with its last element.
+func (tx *Tx) removeElements(collection, key, tag string, names []string) (int, error) {
+	s, err := tx.structure(collection, key, tag)
+	if err != nil || !s.exists {
+		return 0, err
+	}
+
+	var n int
+	for _, name := range names {
+		err := tx.delete(collection, elementKey(key, name), EventDelete)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if n == 0 {
+		return 0, nil
+	}
+
+	names, err = tx.elementNames(s)
+	if err != nil || len(names) > 0 {
+		return n, err
+	}
+
+	return n, tx.delete(collection, key, EventDelete)
+}
+
+// structure reads the header of the structure stored under a key. A
+// missing key is reported as a structure that does not exist; a key holding
+// another kind of value fails with ErrWrongType.
+func (tx *Tx) structure(collection, key, tag string) (*structure, error) {
+	s := &structure{collection: collection, key: key, tag: tag}
+
+	header, err := tx.get(collection, key)
+	if err == ErrNotFound {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(header, tag) {
+		return nil, fmt.Errorf("%w: %s", ErrWrongType, key)
+	}
+
+	if tag == listTag {
+		if _, err := fmt.Sscan(header[len(tag):], &s.head, &s.tail); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrWrongType, key)
+		}
+	}
+
+	s.header = header
+	s.exists = true
+	s.ttl, err = tx.TTL(collection, key)
+
+	return s, err
+}
+
+// openStructure reads the header of the structure stored under a key for
+// writing. When the structure does not exist, elements left over by
+// evicting its header are deleted.
+func (tx *Tx) openStructure(collection, key, tag string) (*structure, error) {
+	s, err := tx.structure(collection, key, tag)
+	if err != nil || s.exists {
+		return s, err
+	}
+
+	return s, tx.deleteElements(collection, key)
+}
+
+// saveStructure writes the header of a structure if it changed, or deletes
+// it once a list is empty.
+func (tx *Tx) saveStructure(s *structure) error {
+	if s.tag == listTag && s.head == s.tail {
+		if !s.exists {
+			return nil
+		}
+		return tx.delete(s.collection, s.key, EventDelete)
+	}
+
+	header := s.tag
+	if s.tag == listTag {
+		header += strconv.FormatInt(s.head, 10) + " " + strconv.FormatInt(s.tail, 10)
+	}
+
+	if s.exists && header == s.header {
+		return nil
+	}
+
+	return tx.set(s.collection, s.key, header, expiryOptions(s.ttl))
+}
+
+// setElement sets an element of a structure with the expiration of the
+// structure.
+func (tx *Tx) setElement(s *structure, name, value string) error {
+	return tx.set(s.collection, elementKey(s.key, name), value, expiryOptions(s.ttl))
+}
+
+// elements calls fn for every element of a structure in key order until fn
+// returns false.
+func (tx *Tx) elements(s *structure, fn func(name, value string) bool) error {
+	prefix := collectionKey(s.collection, elementKey(s.key, ""))
+
+	var err error
+	iterErr := tx.tx.AscendRange("", prefix, elementsEnd(prefix), tx.db.decodeIterator(len(prefix), &err, fn))
+	if iterErr != nil {
+		return iterErr
+	}
+
+	return err
+}
+
+// elementNames returns the names of the elements of a structure in key
+// order.
+func (tx *Tx) elementNames(s *structure) ([]string, error) {
+	return elementNames(tx.tx, s.collection, s.key)
+}
+
+// deleteElements deletes all elements of the structure stored under a key.
+func (tx *Tx) deleteElements(collection, key string) error {
+	names, err := elementNames(tx.tx, collection, key)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := tx.delete(collection, elementKey(key, name), EventDelete); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expireElements sets the expiration of all elements of the structure
+// stored under a key.
+func (tx *Tx) expireElements(collection, key string, opts *bunt.SetOptions) error {
+	names, err := elementNames(tx.tx, collection, key)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		elemKey := elementKey(key, name)
+
+		value, err := tx.get(collection, elemKey)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := tx.set(collection, elemKey, value, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// elementNames returns the names of the elements of the structure stored
+// under a key in key order.
+func elementNames(btx *bunt.Tx, collection, key string) ([]string, error) {
+	prefix := collectionKey(collection, elementKey(key, ""))
+
+	var names []string
+	err := btx.AscendRange("", prefix, elementsEnd(prefix), func(k, _ string) bool {
+		names = append(names, k[len(prefix):])
+		return true
+	})
+
+	return names, err
+}
+
+// holdsStructure reports whether the key in a collection holds the header
+// of a structure.
+func (tx *Tx) holdsStructure(collection, key string) bool {
+	stored, err := tx.tx.Get(collectionKey(collection, key))
+	if err != nil {
+		return false
+	}
+
+	value, err := tx.db.decodeValue(stored)
+	return err == nil && isStructure(value)
+}
+
+// isStructure reports whether a value is the header of a structure.
+func isStructure(value string) bool {
+	return strings.HasPrefix(value, hashTag) || strings.HasPrefix(value, listTag) || strings.HasPrefix(value, setTag)
+}
+
+// elementKey returns the key of an element of the structure stored under
+// key.
+func elementKey(key, name string) string {
+	return key + elementSep + name
+}
+
+// isElementKey reports whether a key within a collection is the key of an
+// element of a structure.
+func isElementKey(key string) bool {
+	return strings.Contains(key, elementSep)
+}
+
+// elementsEnd returns the first key after all keys starting with prefix,
+// which ends in elementSep.
+func elementsEnd(prefix string) string {
+	return prefix[:len(prefix)-1] + "\x01"
+}
@@ -0,0 +1,240 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test hashes
+func TestHash(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.HSet("users", "1", "name", "alice")
+	db.HSet("users", "1", "email", "alice@example.com")
+	db.HSet("users", "1", "name", "bob")
+
+	if value, err := db.HGet("users", "1", "name"); err != nil || value != "bob" {
+		t.Errorf("HGet() = %v, %v, want %v", value, err, "bob")
+	}
+
+	if _, err := db.HGet("users", "1", "age"); err != ErrNotFound {
+		t.Errorf("HGet() = %v, want %v", err, ErrNotFound)
+	}
+
+	want := map[string]string{"name": "bob", "email": "alice@example.com"}
+	if fields, _ := db.HGetAll("users", "1"); !reflect.DeepEqual(fields, want) {
+		t.Errorf("HGetAll() = %v, want %v", fields, want)
+	}
+
+	if n, _ := db.HDel("users", "1", "name", "age"); n != 1 {
+		t.Errorf("HDel() = %v, want %v", n, 1)
+	}
+
+	// the hash is deleted with its last field
+	db.HDel("users", "1", "email")
+	if keys, _ := db.GetKeysFromCollection("users"); len(keys) != 0 {
+		t.Errorf("GetKeysFromCollection() = %v, want none", keys)
+	}
+
+	if fields, err := db.HGetAll("users", "1"); err != nil || len(fields) != 0 {
+		t.Errorf("HGetAll() = %v, %v, want empty", fields, err)
+	}
+}
+
+// Test lists
+func TestList(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.RPush("queues", "jobs", "b", "c")
+	if n, _ := db.LPush("queues", "jobs", "a", "z"); n != 4 {
+		t.Errorf("LPush() = %v, want %v", n, 4)
+	}
+
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"z", "a", "b", "c"}},
+		{1, 2, []string{"a", "b"}},
+		{-2, 10, []string{"b", "c"}},
+		{3, 1, nil},
+	}
+	for _, tt := range tests {
+		if values, _ := db.LRange("queues", "jobs", tt.start, tt.stop); !reflect.DeepEqual(values, tt.want) {
+			t.Errorf("LRange(%v, %v) = %v, want %v", tt.start, tt.stop, values, tt.want)
+		}
+	}
+
+	if value, _ := db.LPop("queues", "jobs"); value != "z" {
+		t.Errorf("LPop() = %v, want %v", value, "z")
+	}
+
+	if value, _ := db.RPop("queues", "jobs"); value != "c" {
+		t.Errorf("RPop() = %v, want %v", value, "c")
+	}
+
+	db.LPop("queues", "jobs")
+	db.LPop("queues", "jobs")
+	if _, err := db.LPop("queues", "jobs"); err != ErrNotFound {
+		t.Errorf("LPop() = %v, want %v", err, ErrNotFound)
+	}
+
+	if keys, _ := db.GetKeysFromCollection("queues"); len(keys) != 0 {
+		t.Errorf("GetKeysFromCollection() = %v, want none", keys)
+	}
+}
+
+// Test SAdd, SRem, SMembers, SIsMember, SInter and SUnion
+func TestSAdd(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	if n, _ := db.SAdd("tags", "a", "go", "db", "go"); n != 2 {
+		t.Errorf("SAdd() = %v, want %v", n, 2)
+	}
+	db.SAdd("tags", "b", "go", "web")
+
+	if members, _ := db.SMembers("tags", "a"); !reflect.DeepEqual(members, []string{"db", "go"}) {
+		t.Errorf("SMembers() = %v, want %v", members, []string{"db", "go"})
+	}
+
+	if ok, _ := db.SIsMember("tags", "a", "db"); !ok {
+		t.Errorf("SIsMember() = %v, want %v", ok, true)
+	}
+
+	if ok, _ := db.SIsMember("tags", "b", "db"); ok {
+		t.Errorf("SIsMember() = %v, want %v", ok, false)
+	}
+
+	if members, _ := db.SInter("tags", "a", "b"); !reflect.DeepEqual(members, []string{"go"}) {
+		t.Errorf("SInter() = %v, want %v", members, []string{"go"})
+	}
+
+	if members, _ := db.SUnion("tags", "a", "b", "c"); !reflect.DeepEqual(members, []string{"db", "go", "web"}) {
+		t.Errorf("SUnion() = %v, want %v", members, []string{"db", "go", "web"})
+	}
+
+	if n, _ := db.SRem("tags", "a", "go", "web"); n != 1 {
+		t.Errorf("SRem() = %v, want %v", n, 1)
+	}
+}
+
+// Test structures fail on keys holding other kinds of values
+func TestStructureWrongType(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.SetToCollection("things", "plain", "value")
+	db.SAdd("things", "set", "a")
+
+	if err := db.HSet("things", "plain", "f", "v"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HSet() = %v, want %v", err, ErrWrongType)
+	}
+
+	if _, err := db.RPush("things", "set", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("RPush() = %v, want %v", err, ErrWrongType)
+	}
+}
+
+// Test expiration and deletion apply to the whole structure
+func TestStructureExpiration(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.HSet("users", "1", "name", "alice")
+	if err := db.ExpireInCollection("users", "1", time.Hour); err != nil {
+		t.Fatalf("ExpireInCollection() = %v", err)
+	}
+
+	// new fields share the expiration
+	db.HSet("users", "1", "email", "alice@example.com")
+	keys, _ := db.GetKeysFromCollection("users")
+	for _, key := range keys {
+		if ttl, _ := db.TTLInCollection("users", key); ttl <= time.Minute {
+			t.Errorf("TTLInCollection(%q) = %v, want about %v", key, ttl, time.Hour)
+		}
+	}
+
+	db.PersistInCollection("users", "1")
+	for _, key := range keys {
+		if ttl, _ := db.TTLInCollection("users", key); ttl != NoExpiration {
+			t.Errorf("TTLInCollection(%q) = %v, want %v", key, ttl, NoExpiration)
+		}
+	}
+
+	if err := db.DeleteFromCollection("users", "1"); err != nil {
+		t.Fatalf("DeleteFromCollection() = %v", err)
+	}
+	if keys, _ := db.GetKeysFromCollection("users"); len(keys) != 0 {
+		t.Errorf("GetKeysFromCollection() = %v, want none", keys)
+	}
+
+	db.RPush("lists", "l", "a", "b")
+	db.ExpireInCollection("lists", "l", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if values, _ := db.LRange("lists", "l", 0, -1); len(values) != 0 {
+		t.Errorf("LRange() = %v, want none", values)
+	}
+
+	// a new list does not see the elements of the expired one
+	db.RPush("lists", "l", "c")
+	if values, _ := db.LRange("lists", "l", 0, -1); !reflect.DeepEqual(values, []string{"c"}) {
+		t.Errorf("LRange() = %v, want %v", values, []string{"c"})
+	}
+}
+
+// Test the elements of structures are left out of key listings
+func TestStructureKeys(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("data"))
+	defer db.Close()
+
+	db.Set("a", "1", 0)
+	db.HSet("data", "h", "f", "v")
+	db.HSet("data", "h", "g", "w")
+	db.SAdd("data", "s", "x", "y")
+
+	want := []string{"a", "h", "s"}
+
+	keys, err := db.GetKeys()
+	if err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeys() = %v, %v, want %v", keys, err, want)
+	}
+
+	keys, err = db.GetKeysFromCollectionCtx(context.Background(), "data")
+	if err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollectionCtx() = %v, %v, want %v", keys, err, want)
+	}
+
+	keys, _, err = db.keysPage(context.Background(), "data", "", "h", 10)
+	if want := []string{"s"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("keysPage() = %v, %v, want %v", keys, err, want)
+	}
+
+	stats, err := db.Stats()
+	if err != nil || stats.Collections["data"].Keys != 3 {
+		t.Errorf("Stats() = %v, %v, want %v", stats.Collections["data"], err, "3 keys")
+	}
+
+	collStats, err := db.CollectionStats("data")
+	if err != nil || collStats.Keys != 3 {
+		t.Errorf("CollectionStats() = %+v, %v, want %v", collStats, err, "3 keys")
+	}
+
+	// deleting by condition leaves structures whole
+	err = db.DeleteWhere(func(key, value string) bool {
+		return value == "v"
+	})
+	if err != nil {
+		t.Errorf("DeleteWhere() = %v, want %v", err, "nil")
+	}
+
+	fields, err := db.HGetAll("data", "h")
+	if want := map[string]string{"f": "v", "g": "w"}; err != nil || !reflect.DeepEqual(fields, want) {
+		t.Errorf("HGetAll() = %v, %v, want %v", fields, err, want)
+	}
+}
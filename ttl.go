@@ -0,0 +1,186 @@
+package swmemdb
+
+import (
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// NoExpiration is the time to live reported for keys that never expire.
+const NoExpiration time.Duration = -1
+
+// TTL returns the remaining time to live of a key, or NoExpiration if the key
+// never expires.
+func (db *DB) TTL(key string) (time.Duration, error) {
+	return db.TTLInCollection(db.collection, key)
+}
+
+// Expire sets the time to live of an existing key. A zero or negative
+// duration deletes the key.
+func (db *DB) Expire(key string, d time.Duration) error {
+	return db.ExpireInCollection(db.collection, key, d)
+}
+
+// ExpireAt makes an existing key expire at t. A time in the past deletes the
+// key.
+func (db *DB) ExpireAt(key string, t time.Time) error {
+	return db.ExpireAtInCollection(db.collection, key, t)
+}
+
+// Persist removes the expiration of an existing key.
+func (db *DB) Persist(key string) error {
+	return db.PersistInCollection(db.collection, key)
+}
+
+// Touch refreshes the time to live of an existing key that expires to d
+// from now, e.g. to keep a session alive while it is used. Keys that never
+// expire are left as they are. A zero or negative d removes the expiration,
+// like it does for Set.
+func (db *DB) Touch(key string, d time.Duration) error {
+	return db.TouchInCollection(db.collection, key, d)
+}
+
+// Exists reports whether a key exists. Unlike reading the value, it does
+// not change the expiration, which only Expire, ExpireAt, Persist and Touch
+// do.
+func (db *DB) Exists(key string) (bool, error) {
+	return db.ExistsInCollection(db.collection, key)
+}
+
+// TTLInCollection returns the remaining time to live of a key in a
+// collection, or NoExpiration if the key never expires.
+func (db *DB) TTLInCollection(collection, key string) (time.Duration, error) {
+	var ttl time.Duration
+
+	err := db.View(func(tx *Tx) error {
+		var err error
+		ttl, err = tx.TTL(collection, key)
+		return err
+	})
+
+	return ttl, err
+}
+
+// ExpireInCollection sets the time to live of an existing key in a
+// collection. A zero or negative duration deletes the key.
+func (db *DB) ExpireInCollection(collection, key string, d time.Duration) error {
+	return db.Tx(func(tx *Tx) error {
+		return tx.Expire(collection, key, d)
+	})
+}
+
+// ExpireAtInCollection makes an existing key in a collection expire at t. A
+// time in the past deletes the key.
+func (db *DB) ExpireAtInCollection(collection, key string, t time.Time) error {
+	return db.ExpireInCollection(collection, key, time.Until(t))
+}
+
+// PersistInCollection removes the expiration of an existing key in a
+// collection.
+func (db *DB) PersistInCollection(collection, key string) error {
+	return db.Tx(func(tx *Tx) error {
+		return tx.Persist(collection, key)
+	})
+}
+
+// TouchInCollection refreshes the time to live of an existing key in a
+// collection, see Touch.
+func (db *DB) TouchInCollection(collection, key string, d time.Duration) error {
+	return db.Tx(func(tx *Tx) error {
+		return tx.Touch(collection, key, d)
+	})
+}
+
+// ExistsInCollection reports whether a key exists in a collection, see
+// Exists.
+func (db *DB) ExistsInCollection(collection, key string) (bool, error) {
+	var exists bool
+
+	err := db.View(func(tx *Tx) error {
+		_, err := tx.tx.Get(collectionKey(collection, key))
+		if err == ErrNotFound {
+			return nil
+		}
+
+		exists = err == nil
+		return err
+	})
+
+	return exists, err
+}
+
+// TTL returns the remaining time to live of a key in a collection, or
+// NoExpiration if the key never expires.
+func (tx *Tx) TTL(collection, key string) (time.Duration, error) {
+	ttl, err := tx.tx.TTL(collectionKey(collection, key))
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl < 0 {
+		return NoExpiration, nil
+	}
+
+	return ttl, nil
+}
+
+// Expire sets the time to live of an existing key in a collection. A zero or
+// negative duration deletes the key.
+func (tx *Tx) Expire(collection, key string, d time.Duration) error {
+	value, err := tx.get(collection, key)
+	if err != nil {
+		return err
+	}
+
+	if d <= 0 {
+		return tx.Delete(collection, key)
+	}
+
+	opts := &bunt.SetOptions{Expires: true, TTL: d}
+	if err := tx.set(collection, key, value, opts); err != nil {
+		return err
+	}
+
+	if isStructure(value) {
+		return tx.expireElements(collection, key, opts)
+	}
+
+	return nil
+}
+
+// Persist removes the expiration of an existing key in a collection.
+func (tx *Tx) Persist(collection, key string) error {
+	value, err := tx.get(collection, key)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.set(collection, key, value, nil); err != nil {
+		return err
+	}
+
+	if isStructure(value) {
+		return tx.expireElements(collection, key, nil)
+	}
+
+	return nil
+}
+
+// Touch refreshes the time to live of an existing key in a collection, see
+// DB.Touch.
+func (tx *Tx) Touch(collection, key string, d time.Duration) error {
+	ttl, err := tx.TTL(collection, key)
+	if err != nil {
+		return err
+	}
+
+	if ttl == NoExpiration {
+		return nil
+	}
+
+	if d <= 0 {
+		return tx.Persist(collection, key)
+	}
+
+	return tx.Expire(collection, key, d)
+}
@@ -0,0 +1,263 @@
+package swmemdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test TTL on keys with and without expiration
+func TestTTL(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	err := db.Set("expiring", "value", time.Minute)
+	if err != nil {
+		t.Errorf("Set() = %v, want %v", err, "nil")
+	}
+
+	err = db.SetWithNoExpiration("forever", "value")
+	if err != nil {
+		t.Errorf("SetWithNoExpiration() = %v, want %v", err, "nil")
+	}
+
+	ttl, err := db.TTL("expiring")
+	if err != nil {
+		t.Errorf("TTL() = %v, want %v", err, "nil")
+	}
+
+	if ttl <= 59*time.Second || ttl > time.Minute {
+		t.Errorf("TTL() = %v, want %v", ttl, time.Minute)
+	}
+
+	ttl, err = db.TTL("forever")
+	if err != nil {
+		t.Errorf("TTL() = %v, want %v", err, "nil")
+	}
+
+	if ttl != NoExpiration {
+		t.Errorf("TTL() = %v, want %v", ttl, NoExpiration)
+	}
+
+	_, err = db.TTL("missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("TTL() = %v, want %v", err, ErrNotFound)
+	}
+}
+
+// Test Expire, ExpireAt and Persist
+func TestExpireAndPersist(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	err := db.SetWithNoExpiration("key", "value")
+	if err != nil {
+		t.Errorf("SetWithNoExpiration() = %v, want %v", err, "nil")
+	}
+
+	err = db.Expire("key", time.Hour)
+	if err != nil {
+		t.Errorf("Expire() = %v, want %v", err, "nil")
+	}
+
+	ttl, _ := db.TTL("key")
+	if ttl <= 59*time.Minute {
+		t.Errorf("TTL() = %v, want %v", ttl, time.Hour)
+	}
+
+	err = db.ExpireAt("key", time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Errorf("ExpireAt() = %v, want %v", err, "nil")
+	}
+
+	ttl, _ = db.TTL("key")
+	if ttl <= 119*time.Minute {
+		t.Errorf("TTL() = %v, want %v", ttl, 2*time.Hour)
+	}
+
+	err = db.Persist("key")
+	if err != nil {
+		t.Errorf("Persist() = %v, want %v", err, "nil")
+	}
+
+	ttl, _ = db.TTL("key")
+	if ttl != NoExpiration {
+		t.Errorf("TTL() = %v, want %v", ttl, NoExpiration)
+	}
+
+	val, err := db.Get("key")
+	if err != nil || val != "value" {
+		t.Errorf("Get() = %v, %v, want %v", val, err, "value")
+	}
+
+	// expiring in the past deletes the key
+	err = db.ExpireAt("key", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Errorf("ExpireAt() = %v, want %v", err, "nil")
+	}
+
+	exists, err := db.Exists("key")
+	if err != nil || exists {
+		t.Errorf("Exists() = %v, %v, want %v", exists, err, false)
+	}
+}
+
+// Test Touch refreshes the time to live of expiring keys only
+func TestTouch(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	db.Set("session", "1", time.Minute)
+	db.Set("config", "1", 0)
+
+	if err := db.Touch("session", time.Hour); err != nil {
+		t.Errorf("Touch() = %v, want %v", err, "nil")
+	}
+
+	ttl, err := db.TTL("session")
+	if err != nil || ttl <= time.Minute || ttl > time.Hour {
+		t.Errorf("TTL() = %v, %v, want about %v", ttl, err, time.Hour)
+	}
+
+	// keys that never expire are left as they are
+	if err := db.Touch("config", time.Hour); err != nil {
+		t.Errorf("Touch() = %v, want %v", err, "nil")
+	}
+
+	if ttl, err := db.TTL("config"); err != nil || ttl != NoExpiration {
+		t.Errorf("TTL() = %v, %v, want %v", ttl, err, NoExpiration)
+	}
+
+	// a zero duration removes the expiration
+	if err := db.Touch("session", 0); err != nil {
+		t.Errorf("Touch() = %v, want %v", err, "nil")
+	}
+
+	if ttl, err := db.TTL("session"); err != nil || ttl != NoExpiration {
+		t.Errorf("TTL() = %v, %v, want %v", ttl, err, NoExpiration)
+	}
+
+	if err := db.Touch("missing", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Touch() = %v, want %v", err, ErrNotFound)
+	}
+}
+
+// Test the collection variants with missing keys
+func TestTTLInCollectionMissingKey(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	err := db.ExpireInCollection("users", "missing", time.Minute)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ExpireInCollection() = %v, want %v", err, ErrNotFound)
+	}
+
+	err = db.PersistInCollection("users", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("PersistInCollection() = %v, want %v", err, ErrNotFound)
+	}
+
+	err = db.TouchInCollection("users", "missing", time.Minute)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("TouchInCollection() = %v, want %v", err, ErrNotFound)
+	}
+
+	err = db.SetToCollection("users", "alice", "1", time.Minute)
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	exists, err := db.ExistsInCollection("users", "alice")
+	if err != nil || !exists {
+		t.Errorf("ExistsInCollection() = %v, %v, want %v", exists, err, true)
+	}
+
+	ttl, err := db.TTLInCollection("users", "alice")
+	if err != nil || ttl <= 0 {
+		t.Errorf("TTLInCollection() = %v, %v, want %v", ttl, err, time.Minute)
+	}
+}
+
+// Test that a zero expiration stores a key that never expires
+func TestSetWithZeroExpiration(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	err := db.Set("key", "value", 0)
+	if err != nil {
+		t.Errorf("Set() = %v, want %v", err, "nil")
+	}
+
+	ttl, err := db.TTL("key")
+	if err != nil {
+		t.Errorf("TTL() = %v, want %v", err, "nil")
+	}
+
+	if ttl != NoExpiration {
+		t.Errorf("TTL() = %v, want %v", ttl, NoExpiration)
+	}
+}
+
+// Test that UpdateToCollection keeps the remaining expiration
+func TestUpdateToCollectionKeepsTTL(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	err := db.SetToCollection("users", "alice", "1", time.Minute)
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	err = db.UpdateToCollection("users", "alice", "2")
+	if err != nil {
+		t.Errorf("UpdateToCollection() = %v, want %v", err, "nil")
+	}
+
+	ttl, err := db.TTLInCollection("users", "alice")
+	if err != nil {
+		t.Errorf("TTLInCollection() = %v, want %v", err, "nil")
+	}
+
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTLInCollection() = %v, want %v", ttl, time.Minute)
+	}
+}
+
+// Test a zero expiration never expires and UpdateToCollection keeps the
+// remaining time to live. Before, a zero expiration made the value expire
+// immediately.
+func TestZeroExpiration(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("testtable"))
+	defer db.Close()
+
+	db.Set("set", "value", 0)
+	db.Update("update", "value", 0)
+	db.SetToCollection("users", "alice", "1")
+	time.Sleep(10 * time.Millisecond)
+
+	for _, key := range []string{"set", "update"} {
+		if ttl, err := db.TTL(key); err != nil || ttl != NoExpiration {
+			t.Errorf("TTL(%q) = %v, %v, want %v", key, ttl, err, NoExpiration)
+		}
+	}
+
+	if ttl, err := db.TTLInCollection("users", "alice"); err != nil || ttl != NoExpiration {
+		t.Errorf("TTLInCollection() = %v, %v, want %v", ttl, err, NoExpiration)
+	}
+
+	// updating keeps the remaining time to live, or the lack of one
+	db.UpdateToCollection("users", "alice", "2")
+	if ttl, _ := db.TTLInCollection("users", "alice"); ttl != NoExpiration {
+		t.Errorf("TTLInCollection() = %v, want %v", ttl, NoExpiration)
+	}
+
+	db.SetToCollection("users", "bob", "1", time.Hour)
+	db.UpdateToCollection("users", "bob", "2")
+	if ttl, _ := db.TTLInCollection("users", "bob"); ttl <= time.Minute || ttl > time.Hour {
+		t.Errorf("TTLInCollection() = %v, want about %v", ttl, time.Hour)
+	}
+
+	if value, _ := db.GetFromCollection("users", "bob"); value != "2" {
+		t.Errorf("GetFromCollection() = %v, want %v", value, "2")
+	}
+}
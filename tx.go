@@ -0,0 +1,365 @@
+package swmemdb
+
+import (
+	"context"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// Tx is a read-write transaction spanning any number of collections. All
+// changes made through a Tx are committed together, or not at all.
+type Tx struct {
+	db        *DB
+	tx        *bunt.Tx
+	ctx       context.Context
+	events    []Event
+	mutations []mutation
+	changed   map[string]struct{}
+	usage     []usageChange
+}
+
+// Tx runs fn inside a single read-write transaction. If fn returns an error
+// every change made through tx is rolled back and the error is returned.
+// Replicas are read-only and fail with ErrReadOnly.
+func (db *DB) Tx(fn func(tx *Tx) error) error {
+	return db.TxCtx(context.Background(), fn)
+}
+
+// TxCtx is like Tx, but fails with the error of ctx if ctx is done before
+// the write lock is taken. The context is available to fn through
+// tx.Context and is passed on to watchers in Event.Context.
+func (db *DB) TxCtx(ctx context.Context, fn func(tx *Tx) error) error {
+	if db.opts.replicaOf != "" {
+		return ErrReadOnly
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.update(ctx, db.db, fn)
+}
+
+// update runs fn inside a read-write transaction of bdb and publishes the
+// events and mutations recorded by the transaction once it has been
+// committed.
+func (db *DB) update(ctx context.Context, bdb *bunt.DB, fn func(tx *Tx) error) error {
+	tx := &Tx{db: db, ctx: ctx}
+
+	// replicate mutations in commit order
+	db.writeMu.Lock()
+	err := bdb.Update(func(btx *bunt.Tx) error {
+		// give up if ctx was done while waiting for the lock
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tx.tx = btx
+		return fn(tx)
+	})
+	if err == nil {
+		db.usage.commit(tx.usage)
+		db.repl.publish(tx.mutations)
+	}
+	db.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	db.feed.publish(tx.events)
+
+	// stay within the limits
+	if len(tx.usage) > 0 {
+		db.evict()
+	}
+
+	return nil
+}
+
+// View runs fn inside a single read-only transaction. Writes made through tx
+// fail.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	return db.ViewCtx(context.Background(), fn)
+}
+
+// ViewCtx is like View, but fails with the error of ctx if ctx is done
+// before the transaction starts.
+func (db *DB) ViewCtx(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.db.View(func(btx *bunt.Tx) error {
+		return fn(&Tx{db: db, tx: btx, ctx: ctx})
+	})
+}
+
+// Context returns the context of the transaction.
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Set sets the value for a key in a collection. An optional expiration may
+// be given, without one the value never expires.
+func (tx *Tx) Set(collection, key, value string, exps ...time.Duration) error {
+	var exp time.Duration
+	if len(exps) > 0 {
+		exp = exps[0]
+	}
+
+	return tx.set(collection, key, value, expiryOptions(exp))
+}
+
+// Get gets the value for a key in a collection, including changes made
+// earlier in the transaction.
+func (tx *Tx) Get(collection, key string) (value string, err error) {
+	start := tx.db.metricsStart()
+	defer func() { tx.db.observe(collection, opGet, start, err) }()
+
+	dbKey := collectionKey(collection, key)
+	stored, err := tx.tx.Get(dbKey)
+	if err != nil {
+		return "", err
+	}
+
+	if tx.db.opts.limited() {
+		tx.db.usage.touch(dbKey)
+	}
+
+	return tx.db.decodeValue(stored)
+}
+
+// get gets the value for a key in a collection like Get, for reads the
+// database makes itself. They are not counted in the metrics and do not
+// count as accesses for eviction.
+func (tx *Tx) get(collection, key string) (string, error) {
+	stored, err := tx.tx.Get(collectionKey(collection, key))
+	if err != nil {
+		return "", err
+	}
+
+	return tx.db.decodeValue(stored)
+}
+
+// Delete deletes a key/value pair from a collection. Deleting a hash, list
+// or set deletes its elements too.
+func (tx *Tx) Delete(collection, key string) error {
+	structure := tx.holdsStructure(collection, key)
+
+	if err := tx.delete(collection, key, EventDelete); err != nil {
+		return err
+	}
+
+	if structure {
+		return tx.deleteElements(collection, key)
+	}
+
+	return nil
+}
+
+// Keys returns all keys of a collection, including changes made earlier in
+// the transaction. The elements of hashes, lists and sets are left out.
+func (tx *Tx) Keys(collection string) ([]string, error) {
+	return tx.keys(collection, false)
+}
+
+// keys returns all keys of a collection, with the elements of structures if
+// elements is set.
+func (tx *Tx) keys(collection string, elements bool) ([]string, error) {
+	var keys []string
+
+	err := tx.tx.AscendKeys(collectionPattern(collection), func(key, value string) bool {
+		// strip the collection name
+		key = key[len(collection)+1:]
+		if elements || !isElementKey(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	return keys, err
+}
+
+// set sets the value for a key in a collection and records the change.
+func (tx *Tx) set(collection, key, value string, opts *bunt.SetOptions) error {
+	return tx.setKey(collectionKey(collection, key), collection, key, value, opts)
+}
+
+// setKey sets the value of a database key and records the change under the
+// given collection and key.
+func (tx *Tx) setKey(dbKey, collection, key, value string, opts *bunt.SetOptions) (err error) {
+	start := tx.db.metricsStart()
+	defer func() { tx.db.observe(collection, opSet, start, err) }()
+
+	stored, err := tx.db.encodeValue(collection, value)
+	if err != nil {
+		return err
+	}
+
+	return tx.setStoredKey(dbKey, collection, key, stored, value, opts)
+}
+
+// setStoredKey sets a database key to a value that is already in its stored
+// form and records the change under the given collection and key.
+func (tx *Tx) setStoredKey(dbKey, collection, key, stored, value string, opts *bunt.SetOptions) error {
+	previous, replaced, err := tx.tx.Set(dbKey, stored, opts)
+	if err != nil {
+		return err
+	}
+
+	typ := EventSet
+	if replaced {
+		typ = EventUpdate
+	}
+	tx.record(typ, collection, key, previous, value)
+	if tx.changed != nil {
+		if old, err := tx.db.decodeValue(previous); !replaced || err != nil || old != value {
+			tx.changed[dbKey] = struct{}{}
+		}
+	}
+	tx.replicateSet(dbKey, stored, opts)
+
+	return nil
+}
+
+// replicateSet records a database key set to a stored value for replicas
+// and eviction.
+func (tx *Tx) replicateSet(dbKey, stored string, opts *bunt.SetOptions) {
+	var ttl time.Duration
+	if opts != nil && opts.Expires {
+		ttl = opts.TTL
+	}
+	tx.replicate(mutation{Type: EventSet, Key: dbKey, Value: stored, TTL: ttl})
+
+	change := usageChange{key: dbKey, size: int64(len(dbKey) + len(stored))}
+	if ttl > 0 {
+		change.expiresAt = time.Now().Add(ttl)
+	}
+	tx.trackUsage(change)
+}
+
+// delete deletes a key/value pair from a collection and records the change
+// as an event of the given type.
+func (tx *Tx) delete(collection, key string, typ EventType) error {
+	start := tx.db.metricsStart()
+	err := tx.deleteKey(collectionKey(collection, key), collection, key, typ)
+	tx.db.observe(collection, opDelete, start, err)
+
+	return err
+}
+
+// deleteKey deletes a database key and records the change under the given
+// collection and key as an event of the given type.
+func (tx *Tx) deleteKey(dbKey, collection, key string, typ EventType) error {
+	previous, err := tx.tx.Delete(dbKey)
+	if err != nil {
+		return err
+	}
+
+	tx.record(typ, collection, key, previous, "")
+	tx.replicate(mutation{Type: typ, Key: dbKey})
+	tx.trackUsage(usageChange{key: dbKey, deleted: true})
+	if tx.changed != nil {
+		tx.changed[dbKey] = struct{}{}
+	}
+
+	return nil
+}
+
+// record records a change to be published once the transaction commits.
+// The old value is given in its stored form. Nothing is recorded when nobody
+// is watching.
+func (tx *Tx) record(typ EventType, collection, key, oldStored, newValue string) {
+	if !tx.db.feed.active() {
+		return
+	}
+
+	// an undecodable old value is reported as empty
+	oldValue, _ := tx.db.decodeValue(oldStored)
+
+	tx.events = append(tx.events, Event{
+		Type:       typ,
+		Collection: collection,
+		Key:        key,
+		OldValue:   oldValue,
+		NewValue:   newValue,
+		At:         time.Now(),
+		Context:    tx.ctx,
+	})
+}
+
+// replicate records a mutation to be sent to replicas once the transaction
+// commits. Nothing is recorded when no replica can connect.
+func (tx *Tx) replicate(m mutation) {
+	if !tx.db.repl.enabled.Load() {
+		return
+	}
+
+	tx.mutations = append(tx.mutations, m)
+}
+
+// batchOp is a single write recorded by a Batch.
+type batchOp struct {
+	delete     bool
+	collection string
+	key        string
+	value      string
+	exp        time.Duration
+}
+
+// Batch records writes to any number of collections and applies them in a
+// single transaction. Unlike Tx, no lock is held while the batch is built.
+type Batch struct {
+	ops []batchOp
+}
+
+// Batch runs fn to build a batch of writes and applies them atomically. If fn
+// or any of the writes fails, nothing is applied.
+func (db *DB) Batch(fn func(b *Batch) error) error {
+	b := &Batch{}
+	if err := fn(b); err != nil {
+		return err
+	}
+
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	return db.Tx(func(tx *Tx) error {
+		for _, op := range b.ops {
+			var err error
+			if op.delete {
+				err = tx.Delete(op.collection, op.key)
+			} else {
+				err = tx.Set(op.collection, op.key, op.value, op.exp)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Set records setting the value for a key in a collection. An optional
+// expiration may be given, without one the value never expires.
+func (b *Batch) Set(collection, key, value string, exps ...time.Duration) {
+	var exp time.Duration
+	if len(exps) > 0 {
+		exp = exps[0]
+	}
+
+	b.ops = append(b.ops, batchOp{collection: collection, key: key, value: value, exp: exp})
+}
+
+// Delete records deleting a key/value pair from a collection. Applying the
+// batch fails if the key does not exist.
+func (b *Batch) Delete(collection, key string) {
+	b.ops = append(b.ops, batchOp{delete: true, collection: collection, key: key})
+}
+
+// Len returns the number of recorded writes.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
@@ -0,0 +1,178 @@
+package swmemdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// Test a transaction spanning two collections
+func TestTxCommit(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	err := db.Tx(func(tx *Tx) error {
+		if err := tx.Set("users", "alice", "1"); err != nil {
+			return err
+		}
+		if err := tx.Set("users", "bob", "2", time.Minute); err != nil {
+			return err
+		}
+		if err := tx.Set("emails", "alice@example.com", "alice"); err != nil {
+			return err
+		}
+
+		// reads see the writes of the transaction
+		val, err := tx.Get("users", "alice")
+		if err != nil {
+			return err
+		}
+		if val != "1" {
+			t.Errorf("Get() = %v, want %v", val, "1")
+		}
+
+		keys, err := tx.Keys("users")
+		if err != nil {
+			return err
+		}
+		if want := []string{"alice", "bob"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("Keys() = %v, want %v", keys, want)
+		}
+
+		return tx.Delete("users", "bob")
+	})
+	if err != nil {
+		t.Fatalf("Tx() = %v, want %v", err, "nil")
+	}
+
+	keys, err := db.GetKeysFromCollection("users")
+	if err != nil {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"alice"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+
+	val, err := db.GetFromCollection("emails", "alice@example.com")
+	if err != nil {
+		t.Errorf("GetFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if val != "alice" {
+		t.Errorf("GetFromCollection() = %v, want %v", val, "alice")
+	}
+}
+
+// Test that a failing transaction rolls back all of its writes
+func TestTxRollback(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	err := db.SetToCollection("users", "alice", "1", time.Minute)
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	errAbort := errors.New("abort")
+	err = db.Tx(func(tx *Tx) error {
+		if err := tx.Set("users", "alice", "changed"); err != nil {
+			return err
+		}
+		if err := tx.Set("emails", "alice@example.com", "alice"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Tx() = %v, want %v", err, errAbort)
+	}
+
+	val, err := db.GetFromCollection("users", "alice")
+	if err != nil {
+		t.Errorf("GetFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if val != "1" {
+		t.Errorf("GetFromCollection() = %v, want %v", val, "1")
+	}
+
+	_, err = db.GetFromCollection("emails", "alice@example.com")
+	if !errors.Is(err, buntdb.ErrNotFound) {
+		t.Errorf("GetFromCollection() = %v, want %v", err, buntdb.ErrNotFound)
+	}
+}
+
+// Test Batch applying writes to several collections
+func TestBatch(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	err := db.SetToCollection("users", "carol", "3", time.Minute)
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	err = db.Batch(func(b *Batch) error {
+		b.Set("users", "alice", "1")
+		b.Set("users", "bob", "2", time.Minute)
+		b.Set("emails", "bob@example.com", "bob")
+		b.Delete("users", "carol")
+
+		if b.Len() != 4 {
+			t.Errorf("Len() = %v, want %v", b.Len(), 4)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Batch() = %v, want %v", err, "nil")
+	}
+
+	keys, err := db.GetKeysFromCollection("users")
+	if err != nil {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, want)
+	}
+}
+
+// Test that a failing Batch applies nothing
+func TestBatchRollback(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	// deleting a missing key fails the batch after the first set was applied
+	err := db.Batch(func(b *Batch) error {
+		b.Set("users", "alice", "1")
+		b.Delete("users", "nobody")
+		return nil
+	})
+	if !errors.Is(err, buntdb.ErrNotFound) {
+		t.Errorf("Batch() = %v, want %v", err, buntdb.ErrNotFound)
+	}
+
+	// an error from the builder applies nothing either
+	errAbort := errors.New("abort")
+	err = db.Batch(func(b *Batch) error {
+		b.Set("users", "bob", "2")
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Batch() = %v, want %v", err, errAbort)
+	}
+
+	keys, err := db.GetKeysFromCollection("users")
+	if err != nil {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if len(keys) != 0 {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, "[]")
+	}
+}
@@ -0,0 +1,41 @@
+package swmemdb
+
+// encodeValue converts a value of a collection to the form it is stored in.
+// Values are compressed first and then encrypted.
+func (db *DB) encodeValue(collection, value string) (string, error) {
+	value, err := db.compress(collection, value)
+	if err != nil {
+		return "", err
+	}
+
+	if c := db.cipher.Load(); c != nil {
+		return c.encrypt(value), nil
+	}
+
+	return value, nil
+}
+
+// decodeValue converts a stored value back to the value it was set to.
+func (db *DB) decodeValue(stored string) (string, error) {
+	value, err := decrypt(db.cipher.Load(), stored)
+	if err != nil {
+		return "", err
+	}
+
+	return db.decompress(value)
+}
+
+// decodeIterator returns an iterator passing decoded values to fn. Keys
+// are passed on without their first skip bytes. If a value cannot be
+// decoded, iteration stops and the error is stored in errp.
+func (db *DB) decodeIterator(skip int, errp *error, fn func(key, value string) bool) func(key, value string) bool {
+	return func(key, stored string) bool {
+		value, err := db.decodeValue(stored)
+		if err != nil {
+			*errp = err
+			return false
+		}
+
+		return fn(key[skip:], value)
+	}
+}
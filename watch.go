@@ -0,0 +1,301 @@
+package swmemdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bunt "github.com/tidwall/buntdb"
+)
+
+// EventType is the kind of change an Event describes.
+type EventType int
+
+const (
+	// EventSet is published when a new key is stored.
+	EventSet EventType = iota + 1
+	// EventUpdate is published when the value of an existing key is replaced.
+	EventUpdate
+	// EventDelete is published when a key is deleted.
+	EventDelete
+	// EventExpire is published when a key is removed because it expired.
+	EventExpire
+	// EventEvict is published when a key is evicted to stay within a limit.
+	EventEvict
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	}
+
+	return "unknown"
+}
+
+// Event describes a single change made to the database. Context is the
+// context of the transaction that made the change, carrying its trace and
+// metadata values; it is context.Background() for changes made without one,
+// such as expirations.
+type Event struct {
+	Type       EventType
+	Collection string
+	Key        string
+	OldValue   string
+	NewValue   string
+	At         time.Time
+	Context    context.Context
+}
+
+// OverflowPolicy decides what happens to events for a watcher whose buffer
+// is full.
+type OverflowPolicy int
+
+const (
+	// DropEvents drops the events that do not fit into the buffer.
+	DropEvents OverflowPolicy = iota
+	// BlockWriters blocks the writing goroutine until the watcher has room
+	// for the event or stops watching.
+	BlockWriters
+)
+
+// WatchOptions configures a watcher.
+type WatchOptions struct {
+	// Buffer is the capacity of the event channel. Defaults to 64.
+	Buffer int
+	// Policy decides what happens when the buffer is full.
+	Policy OverflowPolicy
+	// Types limits the watcher to the given event types. All types are
+	// delivered when empty.
+	Types []EventType
+}
+
+// Watch returns a channel receiving an Event for every change made through
+// db to the given collection, or to any collection if collection is empty.
+// Events of a transaction are delivered in order once it has committed. The
+// channel is closed when ctx is done or the database is closed.
+//
+// Expirations are only reported when no OnExpiredSync callback is
+// configured.
+func (db *DB) Watch(ctx context.Context, collection string, opts WatchOptions) (<-chan Event, error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+
+	w := &watcher{
+		collection: collection,
+		opts:       opts,
+		ch:         make(chan Event, opts.Buffer),
+		done:       make(chan struct{}),
+	}
+
+	if err := db.feed.subscribe(w); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			db.feed.unsubscribe(w)
+		case <-w.done:
+		}
+	}()
+
+	return w.ch, nil
+}
+
+// watcher is a single subscription to the feed.
+type watcher struct {
+	collection string
+	opts       WatchOptions
+	ch         chan Event
+	done       chan struct{}
+	stop       sync.Once
+}
+
+// wants reports whether the watcher is interested in ev.
+func (w *watcher) wants(ev Event) bool {
+	if w.collection != "" && w.collection != ev.Collection {
+		return false
+	}
+
+	if len(w.opts.Types) == 0 {
+		return true
+	}
+
+	for _, typ := range w.opts.Types {
+		if typ == ev.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send delivers ev according to the overflow policy of the watcher. Blocked
+// writers are released when closing is closed.
+func (w *watcher) send(ev Event, closing <-chan struct{}) {
+	if w.opts.Policy == BlockWriters {
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+		case <-closing:
+		}
+		return
+	}
+
+	select {
+	case w.ch <- ev:
+	default:
+	}
+}
+
+// feed fans out committed changes to the watchers of a database.
+type feed struct {
+	mu       sync.RWMutex
+	watchers map[*watcher]struct{}
+	closed   bool
+	count    atomic.Int32
+	// done is closed when the feed closes, releasing blocked writers
+	done     chan struct{}
+	initDone sync.Once
+	stop     sync.Once
+}
+
+// closing returns a channel that is closed when the feed closes.
+func (f *feed) closing() chan struct{} {
+	f.initDone.Do(func() { f.done = make(chan struct{}) })
+	return f.done
+}
+
+// active reports whether anybody is watching.
+func (f *feed) active() bool {
+	return f.count.Load() > 0
+}
+
+// subscribe adds a watcher to the feed.
+func (f *feed) subscribe(w *watcher) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return bunt.ErrDatabaseClosed
+	}
+
+	if f.watchers == nil {
+		f.watchers = map[*watcher]struct{}{}
+	}
+	f.watchers[w] = struct{}{}
+	f.count.Add(1)
+
+	return nil
+}
+
+// unsubscribe removes a watcher from the feed and closes its channel.
+func (f *feed) unsubscribe(w *watcher) {
+	// release writers blocked on the watcher before taking the lock
+	w.stop.Do(func() { close(w.done) })
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.watchers[w]; ok {
+		delete(f.watchers, w)
+		f.count.Add(-1)
+		close(w.ch)
+	}
+}
+
+// publish delivers events to all interested watchers.
+func (f *feed) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	closing := f.closing()
+	for _, ev := range events {
+		for w := range f.watchers {
+			if w.wants(ev) {
+				w.send(ev, closing)
+			}
+		}
+	}
+}
+
+// close unsubscribes all watchers and refuses new ones.
+func (f *feed) close() {
+	// release writers blocked on watchers before taking the lock
+	f.stop.Do(func() { close(f.closing()) })
+
+	f.mu.Lock()
+	f.closed = true
+	watchers := make([]*watcher, 0, len(f.watchers))
+	for w := range f.watchers {
+		watchers = append(watchers, w)
+	}
+	f.mu.Unlock()
+
+	for _, w := range watchers {
+		f.unsubscribe(w)
+	}
+}
+
+// expireKeys returns the OnExpired handler for bdb. It deletes the expired
+// keys, publishing an EventExpire for each of them, and then calls next with
+// the keys.
+func (db *DB) expireKeys(bdb *bunt.DB, next func(keys []string)) func(keys []string) {
+	return func(keys []string) {
+		var expired []string
+		err := db.update(context.Background(), bdb, func(tx *Tx) error {
+			for _, key := range keys {
+				// the key may have been set again in the meantime
+				if _, err := tx.tx.TTL(key); err != ErrNotFound {
+					continue
+				}
+
+				value, err := tx.tx.Get(key, true)
+				if err != nil {
+					// already deleted
+					continue
+				}
+
+				// deleting an expired key reports not found
+				if _, err := tx.tx.Delete(key); err != nil && err != ErrNotFound {
+					return err
+				}
+
+				collection, k := splitKey(key)
+				tx.record(EventExpire, collection, k, value, "")
+				tx.replicate(mutation{Type: EventExpire, Key: key})
+				tx.trackUsage(usageChange{key: key, deleted: true})
+				db.observeExpiration(collection)
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+
+		if next != nil {
+			next(keys)
+		}
+
+		if db.opts.onRemoved != nil && len(expired) > 0 {
+			db.opts.onRemoved(expired, RemovedExpired)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package swmemdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// receiveEvent waits for the next event on ch.
+func receiveEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatalf("Watch() channel closed, want event")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch() timed out, want event")
+	}
+
+	return Event{}
+}
+
+// Test that set, update and delete are published
+func TestWatch(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"), WithCollection("users"))
+	defer db.Close()
+
+	ch, err := db.Watch(context.Background(), "users", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	err = db.Set("alice", "1", time.Minute)
+	if err != nil {
+		t.Errorf("Set() = %v, want %v", err, "nil")
+	}
+
+	err = db.SetToCollection("other", "bob", "2")
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	err = db.UpdateToCollection("users", "alice", "2")
+	if err != nil {
+		t.Errorf("UpdateToCollection() = %v, want %v", err, "nil")
+	}
+
+	err = db.Delete("alice")
+	if err != nil {
+		t.Errorf("Delete() = %v, want %v", err, "nil")
+	}
+
+	want := []Event{
+		{Type: EventSet, Collection: "users", Key: "alice", NewValue: "1"},
+		{Type: EventUpdate, Collection: "users", Key: "alice", OldValue: "1", NewValue: "2"},
+		{Type: EventDelete, Collection: "users", Key: "alice", OldValue: "2"},
+	}
+	for _, w := range want {
+		ev := receiveEvent(t, ch)
+		if ev.At.IsZero() {
+			t.Errorf("Event.At = %v, want %v", ev.At, "non zero")
+		}
+
+		if ev.Context == nil {
+			t.Errorf("Event.Context = %v, want %v", ev.Context, "non nil")
+		}
+
+		ev.At, ev.Context = time.Time{}, nil
+		if ev != w {
+			t.Errorf("Watch() = %+v, want %+v", ev, w)
+		}
+	}
+}
+
+// Test that rolled back transactions publish nothing
+func TestWatchRollback(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	ch, err := db.Watch(context.Background(), "", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	errAbort := errors.New("abort")
+	err = db.Tx(func(tx *Tx) error {
+		if err := tx.Set("users", "alice", "1"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Tx() = %v, want %v", err, errAbort)
+	}
+
+	err = db.SetToCollection("orders", "1", "x")
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	ev := receiveEvent(t, ch)
+	if ev.Collection != "orders" || ev.Key != "1" {
+		t.Errorf("Watch() = %+v, want %v", ev, "orders:1")
+	}
+}
+
+// Test that expirations are published and OnExpired is still called
+func TestWatchExpire(t *testing.T) {
+	expired := make(chan []string, 1)
+	db := NewBuntDb(WithMode("memory"), WithOnExpired(func(keys []string) {
+		expired <- keys
+	}))
+	defer db.Close()
+
+	ch, err := db.Watch(context.Background(), "sessions", WatchOptions{Types: []EventType{EventExpire}})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	err = db.SetToCollection("sessions", "abc", "token", 10*time.Millisecond)
+	if err != nil {
+		t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+	}
+
+	ev := receiveEvent(t, ch)
+	if ev.Type != EventExpire || ev.Collection != "sessions" || ev.Key != "abc" || ev.OldValue != "token" {
+		t.Errorf("Watch() = %+v, want %v", ev, "expire of sessions:abc")
+	}
+
+	select {
+	case keys := <-expired:
+		if len(keys) != 1 || keys[0] != "sessions:abc" {
+			t.Errorf("OnExpired() = %v, want %v", keys, "[sessions:abc]")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("OnExpired() was not called")
+	}
+
+	keys, err := db.GetKeysFromCollection("sessions")
+	if err != nil {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", err, "nil")
+	}
+
+	if len(keys) != 0 {
+		t.Errorf("GetKeysFromCollection() = %v, want %v", keys, "[]")
+	}
+}
+
+// Test that a full buffer drops events with the drop policy
+func TestWatchDropPolicy(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	ch, err := db.Watch(context.Background(), "", WatchOptions{Buffer: 2, Policy: DropEvents})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		err := db.SetToCollection("letters", key, key)
+		if err != nil {
+			t.Errorf("SetToCollection() = %v, want %v", err, "nil")
+		}
+	}
+
+	if len(ch) != 2 {
+		t.Errorf("len(Watch()) = %v, want %v", len(ch), 2)
+	}
+
+	if ev := receiveEvent(t, ch); ev.Key != "a" {
+		t.Errorf("Watch() = %v, want %v", ev.Key, "a")
+	}
+}
+
+// Test that the block policy holds back writers until events are received
+func TestWatchBlockPolicy(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+	defer db.Close()
+
+	ch, err := db.Watch(context.Background(), "", WatchOptions{Buffer: 1, Policy: BlockWriters})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, key := range []string{"a", "b", "c"} {
+			db.SetToCollection("letters", key, key)
+		}
+	}()
+
+	for _, want := range []string{"a", "b", "c"} {
+		if ev := receiveEvent(t, ch); ev.Key != want {
+			t.Errorf("Watch() = %v, want %v", ev.Key, want)
+		}
+	}
+
+	<-done
+}
+
+// Test that the channel is closed when the context is done or the database is closed
+func TestWatchClose(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch1, err := db.Watch(ctx, "", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	ch2, err := db.Watch(context.Background(), "", WatchOptions{Policy: BlockWriters})
+	if err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	cancel()
+	for range ch1 {
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Errorf("Close() = %v, want %v", err, "nil")
+	}
+
+	for range ch2 {
+	}
+
+	_, err = db.Watch(context.Background(), "", WatchOptions{})
+	if err == nil {
+		t.Errorf("Watch() = %v, want %v", err, "error")
+	}
+}
+
+// Test Close releases writers blocked on a watcher that does not read
+func TestWatchCloseBlocked(t *testing.T) {
+	db := NewBuntDb(WithMode("memory"))
+
+	if _, err := db.Watch(context.Background(), "", WatchOptions{Buffer: 1, Policy: BlockWriters}); err != nil {
+		t.Fatalf("Watch() = %v, want %v", err, "nil")
+	}
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			db.Set("a", "1", 0)
+		}
+	}()
+
+	// wait for a writer to block on the full buffer
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- db.Close() }()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() = %v, want %v", err, "nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Close() blocked by a writer")
+	}
+}